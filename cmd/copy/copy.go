@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+	"jingoal.com/seaweedfs-adaptor/weedfs"
+)
+
+var (
+	seeds       string
+	replication string
+	collection  string
+	dataCenter  string
+	rack        string
+	ttl         string
+	chunkSize   int64
+
+	idListFile  string
+	concurrency int
+	move        bool
+)
+
+func init() {
+	flag.StringVar(&seeds, "seeds", "localhost:9333", "SeaweedFS master seeds location")
+	flag.StringVar(&replication, "replication", "", "replication type of the copies")
+	flag.StringVar(&collection, "collection", "", "collection of the copies")
+	flag.StringVar(&dataCenter, "dataCenter", "", "data center of the copies")
+	flag.StringVar(&rack, "rack", "", "rack of the copies")
+	flag.StringVar(&ttl, "ttl", "", "TTL of the copies")
+	flag.Int64Var(&chunkSize, "chunk-size", 512*1024, "chunk size of the copies in bytes, 0 means never split")
+
+	flag.StringVar(&idListFile, "list", "", "file of the fids to copy one per line, - means stdin")
+	flag.IntVar(&concurrency, "c", 4, "number of files copying concurrently")
+	flag.BoolVar(&move, "move", false, "remove the sources after copied")
+}
+
+func checkFlags() {
+	if seeds == "" {
+		glog.Exit("Error: master seeds is required.")
+	}
+	if idListFile == "" && flag.NArg() == 0 {
+		glog.Exit("Error: must specify the fids by -list or arguments.")
+	}
+	if err := utils.ValidateTTL(ttl); err != nil {
+		glog.Exitf("Error: %v", err)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+}
+
+// readFids sends the fids of the arguments and the list file to fids,
+// the empty lines and the lines starting with # are skipped.
+func readFids(fids chan<- string) error {
+	defer close(fids)
+	for _, fid := range flag.Args() {
+		fids <- fid
+	}
+	if idListFile == "" {
+		return nil
+	}
+
+	var r io.Reader = os.Stdin
+	if idListFile != "-" {
+		file, err := os.Open(idListFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fid := strings.TrimSpace(scanner.Text())
+		if fid == "" || fid[0] == '#' {
+			continue
+		}
+		fids <- fid
+	}
+	return scanner.Err()
+}
+
+func main() {
+	glog.MaxSize = 1024 * 1024 * 32
+	flag.Parse()
+	checkFlags()
+	defer glog.Flush()
+
+	if chunkSize <= 0 {
+		chunkSize = -1
+	}
+	opts := &weedfs.CopyOptions{
+		CreateOptions: weedfs.CreateOptions{
+			Replication: replication,
+			Collection:  collection,
+			DataCenter:  dataCenter,
+			Rack:        rack,
+			TTL:         ttl,
+			ChunkSize:   chunkSize,
+		},
+		DeleteSource: move,
+	}
+
+	client, err := weedfs.NewClient(weedfs.Options{Seeds: seeds})
+	if err != nil {
+		glog.Exitf("Failed to create client: %v", err)
+	}
+
+	var mu sync.Mutex // serializes the output.
+	var wg sync.WaitGroup
+	var copied, failed int
+	fids := make(chan string, concurrency)
+	startTime := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for fid := range fids {
+				newFid, err := client.Copy(context.Background(), fid, opts)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Printf("%s\t%s\terror %v\n", fid, newFid, err)
+				} else {
+					copied++
+					fmt.Printf("%s\t%s\n", fid, newFid)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	if err := readFids(fids); err != nil {
+		glog.Errorf("Failed to read fids: %v", err)
+	}
+	wg.Wait()
+	elapse := time.Since(startTime)
+
+	glog.Infof("Copied %d files, failed %d, elapse millisecond: %v", copied, failed, float64(elapse.Nanoseconds())/1e6)
+	if failed > 0 {
+		glog.Flush()
+		os.Exit(1)
+	}
+}
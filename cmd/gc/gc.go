@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/weedfs"
+)
+
+var (
+	seeds      string
+	journalDir string
+	minAge     time.Duration
+	dryRun     bool
+	verbose    bool
+)
+
+func init() {
+	flag.StringVar(&seeds, "seeds", "localhost:9333", "SeaweedFS master seeds location")
+	flag.StringVar(&journalDir, "journal-dir", "", "upload journal directory of the clients")
+	flag.DurationVar(&minAge, "min-age", 24*time.Hour, "skip the sessions active within the duration")
+	flag.BoolVar(&dryRun, "dry-run", false, "report the orphaned chunks without deleting them")
+	flag.BoolVar(&verbose, "verbose", false, "list the fids of the reclaimed chunks")
+}
+
+func checkFlags() {
+	if seeds == "" {
+		glog.Exit("Error: master seeds is required.")
+	}
+	if journalDir == "" {
+		glog.Exit("Error: journal directory is required.")
+	}
+}
+
+func main() {
+	glog.MaxSize = 1024 * 1024 * 32
+	flag.Parse()
+	checkFlags()
+	defer glog.Flush()
+
+	client, err := weedfs.NewClient(weedfs.Options{
+		Seeds:      seeds,
+		JournalDir: journalDir,
+	})
+	if err != nil {
+		glog.Exitf("Failed to create client: %v", err)
+	}
+
+	startTime := time.Now()
+	report, err := client.Sweep(context.Background(), weedfs.SweepOptions{
+		MinAge: minAge,
+		DryRun: dryRun,
+	})
+	if err != nil {
+		glog.Exitf("Failed to sweep: %v", err)
+	}
+	elapse := time.Since(startTime)
+
+	fmt.Printf("%s, elapse millisecond: %v\n", report, float64(elapse.Nanoseconds())/1e6)
+	if verbose {
+		for _, fid := range report.Reclaimed {
+			fmt.Printf("reclaimed %s\n", fid)
+		}
+		for _, fid := range report.NotFound {
+			fmt.Printf("not found %s\n", fid)
+		}
+	}
+	for _, e := range report.Errors {
+		fmt.Printf("error %s\n", e)
+	}
+}
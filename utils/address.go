@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressPolicy chooses the address to request a volume server by, the
+// zero value is the public url.
+type AddressPolicy struct {
+	// Internal uses the url of the volume server, the address in the
+	// data center, instead of the public url.
+	Internal bool
+	// Template rewrites the address for NAT or proxies, e.g.
+	// "{host}.nat:{port}" or "gateway:8000/{url}". {url} and {publicUrl}
+	// are the addresses of the volume server, {host} and {port} are of
+	// the one chosen by Internal. Empty means no rewrite.
+	Template string
+}
+
+// Address returns the address of the location by the policy.
+func (p *AddressPolicy) Address(l Location) string {
+	addr := l.PublicUrl
+	if p.Internal || addr == "" {
+		addr = l.Url
+	}
+	if p.Template == "" {
+		return addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "80"
+	}
+	return strings.NewReplacer(
+		"{url}", l.Url,
+		"{publicUrl}", l.PublicUrl,
+		"{host}", host,
+		"{port}", port,
+	).Replace(p.Template)
+}
+
+// SetAddressPolicy sets how the client addresses the volume servers,
+// it should be called before the client is used.
+func (c *Client) SetAddressPolicy(p AddressPolicy) {
+	c.addr = p
+}
+
+// Address returns the address to request the volume server at l.
+func (c *Client) Address(l Location) string {
+	return c.addr.Address(l)
+}
+
+// FileUrl returns the url of fid on the volume server at l.
+func (c *Client) FileUrl(l Location, fid string) string {
+	return fmt.Sprintf("http://%s/%s", c.Address(l), fid)
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestAddressPolicy(t *testing.T) {
+	l := Location{Url: "10.0.0.1:8080", PublicUrl: "vs1.example.com:80"}
+	tests := []struct {
+		policy   AddressPolicy
+		expected string
+	}{
+		{AddressPolicy{}, "vs1.example.com:80"},
+		{AddressPolicy{Internal: true}, "10.0.0.1:8080"},
+		{AddressPolicy{Internal: true, Template: "{host}.nat:{port}"}, "10.0.0.1.nat:8080"},
+		{AddressPolicy{Template: "gateway:8000/{url}"}, "gateway:8000/10.0.0.1:8080"},
+		{AddressPolicy{Template: "{publicUrl}"}, "vs1.example.com:80"},
+	}
+	for _, test := range tests {
+		if addr := test.policy.Address(l); addr != test.expected {
+			t.Errorf("Expect %s by %+v, but %s", test.expected, test.policy, addr)
+		}
+	}
+
+	if addr := (&AddressPolicy{}).Address(Location{Url: "10.0.0.1:8080"}); addr != "10.0.0.1:8080" {
+		t.Errorf("Expect the url without public url, but %s", addr)
+	}
+	c := NewClient(nil, nil)
+	c.SetAddressPolicy(AddressPolicy{Internal: true})
+	if u := c.FileUrl(l, "3,01"); u != "http://10.0.0.1:8080/3,01" {
+		t.Errorf("Expect the internal file url, but %s", u)
+	}
+}
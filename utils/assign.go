@@ -1,9 +1,10 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 
@@ -28,7 +29,21 @@ type AssignResult struct {
 	Error     string `json:"error,omitempty"`
 }
 
+// Location returns the volume server of the fids assigned.
+func (r *AssignResult) Location() Location {
+	return Location{Url: r.Url, PublicUrl: r.PublicUrl}
+}
+
 func Assign(seeds string, r *VolumeAssignRequest) (*AssignResult, error) {
+	return AssignContext(context.Background(), seeds, r)
+}
+
+// AssignContext is like Assign but every request to the master is bound to ctx.
+func AssignContext(ctx context.Context, seeds string, r *VolumeAssignRequest) (*AssignResult, error) {
+	return defaultClient.Assign(ctx, seeds, r)
+}
+
+func (c *Client) Assign(ctx context.Context, seeds string, r *VolumeAssignRequest) (*AssignResult, error) {
 	values := make(url.Values)
 	values.Add("count", strconv.FormatUint(r.Count, 10))
 	if r.Replication != "" {
@@ -53,8 +68,9 @@ func Assign(seeds string, r *VolumeAssignRequest) (*AssignResult, error) {
 	var ret AssignResult
 	var err error
 	var jsonBlob []byte
-	err = RetryPost(seeds, func(seed string) error {
-		jsonBlob, err = Post(fmt.Sprintf("http://%s/dir/assign", seed), values)
+	err = c.retryMasters(ctx, OpAssign, seeds, func(seed string) error {
+		assignUrl := fmt.Sprintf("http://%s/dir/assign", seed)
+		jsonBlob, err = c.Post(ctx, assignUrl, values)
 		glog.V(4).Info("Assign result :", string(jsonBlob))
 
 		if err != nil {
@@ -65,7 +81,7 @@ func Assign(seeds string, r *VolumeAssignRequest) (*AssignResult, error) {
 			return err
 		}
 		if ret.Error != "" || ret.Count <= 0 {
-			return errors.New(ret.Error)
+			return &ServerError{Url: assignUrl, StatusCode: http.StatusOK, Message: ret.Error}
 		}
 		return nil
 	})
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/md5"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Md5Header is the needle pair carrying the md5 of a single needle,
+// the volume server stores it and returns it on read.
+const Md5Header = "Seaweed-Md5"
+
+// PlainMd5Header is the needle pair carrying the md5 of the content of a
+// needle compressed by the client, before compression. Md5Header is of
+// the content stored, gzipped.
+const PlainMd5Header = "Seaweed-Plain-Md5"
+
+// ChecksumError reports the content read does not match its digest.
+type ChecksumError struct {
+	Fid      string
+	Expected string
+	Actual   string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch of %s, expect md5 %s, but %s", e.Fid, e.Expected, e.Actual)
+}
+
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksumMismatch
+}
+
+// Md5Hex returns the md5 of data in hex.
+func Md5Hex(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+// VerifyMd5 checks data against the expected md5 of fid.
+func VerifyMd5(fid string, data []byte, expected string) error {
+	if actual := Md5Hex(data); actual != expected {
+		return &ChecksumError{Fid: fid, Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// verifyReader computes the md5 of the stream, and checks it at EOF.
+type verifyReader struct {
+	rc       io.ReadCloser
+	fid      string
+	h        hash.Hash
+	expected func() (string, error)
+}
+
+// NewVerifyReader returns a reader of rc which fails with a ChecksumError
+// instead of io.EOF if the content of fid does not match the md5 expected.
+// The expected md5 is asked at EOF, an empty one skips the check.
+func NewVerifyReader(rc io.ReadCloser, fid string, expected func() (string, error)) io.ReadCloser {
+	return &verifyReader{rc: rc, fid: fid, h: md5.New(), expected: expected}
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.h.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	expected, verr := r.expected()
+	if verr != nil {
+		return n, verr
+	}
+	if actual := fmt.Sprintf("%x", r.h.Sum(nil)); expected != "" && actual != expected {
+		return n, &ChecksumError{Fid: r.fid, Expected: expected, Actual: actual}
+	}
+
+	return n, err
+}
+
+func (r *verifyReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestVerifyReader(t *testing.T) {
+	content := "hello seaweed"
+	expected := func(md5 string) func() (string, error) {
+		return func() (string, error) { return md5, nil }
+	}
+
+	r := NewVerifyReader(ioutil.NopCloser(strings.NewReader(content)), "1,01", expected(Md5Hex([]byte(content))))
+	if b, err := ioutil.ReadAll(r); err != nil || string(b) != content {
+		t.Errorf("Expect %q, but %q, %v", content, b, err)
+	}
+
+	r = NewVerifyReader(ioutil.NopCloser(strings.NewReader(content)), "1,01", expected(""))
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Errorf("Expect no check without md5, but %v", err)
+	}
+
+	r = NewVerifyReader(ioutil.NopCloser(strings.NewReader(content)), "1,01", expected(Md5Hex([]byte("corrupted"))))
+	_, err := ioutil.ReadAll(r)
+	if ce, ok := err.(*ChecksumError); !ok || ce.Fid != "1,01" {
+		t.Errorf("Expect checksum error of 1,01, but %v", err)
+	}
+}
@@ -1,22 +1,87 @@
 package utils
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"sort"
+)
 
 type ChunkInfo struct {
 	Fid    string `json:"fid"`
 	Offset int64  `json:"offset"`
 	Size   int64  `json:"size"`
+	Md5    string `json:"md5,omitempty"`
+	Nonce  []byte `json:"nonce,omitempty"` // of the chunk encrypted.
 }
 
 type ChunkList []*ChunkInfo
 
+func (s ChunkList) Len() int           { return len(s) }
+func (s ChunkList) Less(i, j int) bool { return s[i].Offset < s[j].Offset }
+func (s ChunkList) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
 type ChunkManifest struct {
 	Name   string    `json:"name,omitempty"`
 	Mime   string    `json:"mime,omitempty"`
 	Size   int64     `json:"size,omitempty"`
+	Md5    string    `json:"md5,omitempty"` // md5 of the whole file.
 	Chunks ChunkList `json:"chunks,omitempty"`
+	// Key is the data key of the chunks encrypted, wrapped by the key
+	// of the domain. Offset and Size of a chunk are of its plaintext.
+	Key []byte `json:"key,omitempty"`
+}
+
+// LoadChunkManifest parses the manifest, the chunks are sorted by offset.
+func LoadChunkManifest(b []byte) (*ChunkManifest, error) {
+	cm := ChunkManifest{}
+	if err := json.Unmarshal(b, &cm); err != nil {
+		return nil, err
+	}
+	sort.Sort(cm.Chunks)
+
+	return &cm, nil
 }
 
 func (cm *ChunkManifest) Marshal() ([]byte, error) {
 	return json.Marshal(cm)
 }
+
+// ChunkView is the part of a chunk covering a range of the file.
+type ChunkView struct {
+	Fid         string
+	Offset      int64 // offset in the chunk.
+	Size        int64
+	LogicOffset int64  // offset in the file.
+	Md5         string // md5 of the chunk if the view covers it whole.
+}
+
+// ViewsAt maps the file range of size bytes from offset onto the chunks,
+// the range is truncated at the end of file.
+func (cm *ChunkManifest) ViewsAt(offset, size int64) []ChunkView {
+	var views []ChunkView
+	stop := offset + size
+	for _, ci := range cm.Chunks {
+		if ci.Offset+ci.Size <= offset || ci.Offset >= stop {
+			continue
+		}
+		start := offset
+		if start < ci.Offset {
+			start = ci.Offset
+		}
+		end := stop
+		if end > ci.Offset+ci.Size {
+			end = ci.Offset + ci.Size
+		}
+		view := ChunkView{
+			Fid:         ci.Fid,
+			Offset:      start - ci.Offset,
+			Size:        end - start,
+			LogicOffset: start,
+		}
+		if view.Size == ci.Size {
+			view.Md5 = ci.Md5
+		}
+		views = append(views, view)
+	}
+
+	return views
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+)
+
+func TestChunkManifestViewsAt(t *testing.T) {
+	cm, err := LoadChunkManifest([]byte(`{"size":25,"chunks":[
+		{"fid":"1,02","offset":10,"size":10,"md5":"b"},
+		{"fid":"1,01","offset":0,"size":10,"md5":"a"},
+		{"fid":"1,03","offset":20,"size":5}]}`))
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	views := cm.ViewsAt(5, 17)
+	expect := []ChunkView{
+		{Fid: "1,01", Offset: 5, Size: 5, LogicOffset: 5},
+		{Fid: "1,02", Offset: 0, Size: 10, LogicOffset: 10, Md5: "b"},
+		{Fid: "1,03", Offset: 0, Size: 2, LogicOffset: 20},
+	}
+	if len(views) != len(expect) {
+		t.Fatalf("Expect %v, but %v", expect, views)
+	}
+	for i := range views {
+		if views[i] != expect[i] {
+			t.Errorf("Expect view %v, but %v", expect[i], views[i])
+		}
+	}
+
+	if views := cm.ViewsAt(25, 10); len(views) != 0 {
+		t.Errorf("Expect no view beyond the end, but %v", views)
+	}
+}
@@ -1,8 +1,8 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -19,33 +19,39 @@ type DeleteResult struct {
 }
 
 func DeleteFile(seeds, fileId string) error {
-	locations, err := LookupFileId(seeds, fileId)
+	return DeleteFileContext(context.Background(), seeds, fileId)
+}
+
+// DeleteFileContext is like DeleteFile but every request is bound to ctx.
+func DeleteFileContext(ctx context.Context, seeds, fileId string) error {
+	return defaultClient.DeleteFile(ctx, seeds, fileId)
+}
+
+func (c *Client) DeleteFile(ctx context.Context, seeds, fileId string) error {
+	locations, err := c.LookupFileId(ctx, seeds, fileId)
 	if err != nil {
 		return err
 	}
 
-	// All replications are deleted means success,
-	// otherwise the error message is return.
-	var errs []string
+	// The volume server deletes the replicas too, so any location
+	// succeeded means success, otherwise the error messages are return.
+	var errs []error
 	for _, location := range locations {
-		fileUrl := fmt.Sprintf("http://%s/%s", location.PublicUrl, fileId)
-		err = Delete(fileUrl)
+		fileUrl := c.FileUrl(location, fileId)
+		err = c.Delete(ctx, fileUrl)
 		if err == nil {
-			break
+			return nil
 		}
-		errs = append(errs, err.Error())
+		errs = append(errs, err)
 	}
 
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "\n"))
-	}
-	return nil
+	return JoinErrors(errs)
 }
 
 func ParseFileId(fid string) (vid, keyCookie string, err error) {
 	commaIndex := strings.Index(fid, ",")
 	if commaIndex <= 0 {
-		return "", "", fmt.Errorf("wrong fid format: %s", fid)
+		return "", "", fmt.Errorf("%w %s", ErrInvalidFid, fid)
 	}
 	return fid[:commaIndex], fid[commaIndex+1:], nil
 }
@@ -56,6 +62,15 @@ type DeleteFilesResult struct {
 }
 
 func DeleteFiles(seeds string, fileIds []string) (*DeleteFilesResult, error) {
+	return DeleteFilesContext(context.Background(), seeds, fileIds)
+}
+
+// DeleteFilesContext is like DeleteFiles but every request is bound to ctx.
+func DeleteFilesContext(ctx context.Context, seeds string, fileIds []string) (*DeleteFilesResult, error) {
+	return defaultClient.DeleteFiles(ctx, seeds, fileIds)
+}
+
+func (c *Client) DeleteFiles(ctx context.Context, seeds string, fileIds []string) (*DeleteFilesResult, error) {
 	vidToFileIds := make(map[string][]string)
 	ret := &DeleteFilesResult{}
 	var vids []string
@@ -63,7 +78,7 @@ func DeleteFiles(seeds string, fileIds []string) (*DeleteFilesResult, error) {
 		vid, _, err := ParseFileId(fileId)
 		if err != nil {
 			ret.Results = append(ret.Results, DeleteResult{
-				Fid:    vid,
+				Fid:    fileId,
 				Status: http.StatusBadRequest,
 				Error:  err.Error()},
 			)
@@ -76,7 +91,7 @@ func DeleteFiles(seeds string, fileIds []string) (*DeleteFilesResult, error) {
 		vidToFileIds[vid] = append(vidToFileIds[vid], fileId)
 	}
 
-	lookupResults, err := LookupVolumeIds(seeds, vids)
+	lookupResults, err := c.LookupVolumeIds(ctx, seeds, vids)
 	if err != nil {
 		return ret, err
 	}
@@ -88,35 +103,30 @@ func DeleteFiles(seeds string, fileIds []string) (*DeleteFilesResult, error) {
 			continue
 		}
 		for _, location := range result.Locations {
-			if _, ok := serverToFileIds[location.Url]; !ok {
-				serverToFileIds[location.Url] = make([]string, 0)
+			server := c.Address(location)
+			if _, ok := serverToFileIds[server]; !ok {
+				serverToFileIds[server] = make([]string, 0)
 			}
-			serverToFileIds[location.Url] = append(
-				serverToFileIds[location.Url], vidToFileIds[vid]...)
+			serverToFileIds[server] = append(
+				serverToFileIds[server], vidToFileIds[vid]...)
 		}
 	}
 
 	var wg sync.WaitGroup
+	var mu sync.Mutex // guards ret.
 
 	for server, fidList := range serverToFileIds {
 		wg.Add(1)
 		go func(server string, fidList []string) {
 			defer wg.Done()
-			values := make(url.Values)
-			for _, fid := range fidList {
-				values.Add("fid", fid)
-			}
-			jsonBlob, err := Post(fmt.Sprintf("http://%s/delete", server), values)
+			result, err := c.BatchDelete(ctx, server, fidList)
+
+			mu.Lock()
+			defer mu.Unlock()
 			if err != nil {
 				ret.Errors = append(ret.Errors, err.Error())
 				return
 			}
-			var result []DeleteResult
-			err = json.Unmarshal(jsonBlob, &result)
-			if err != nil {
-				ret.Errors = append(ret.Errors, err.Error()+" "+string(jsonBlob))
-				return
-			}
 			ret.Results = append(ret.Results, result...)
 		}(server, fidList)
 	}
@@ -124,3 +134,22 @@ func DeleteFiles(seeds string, fileIds []string) (*DeleteFilesResult, error) {
 
 	return ret, nil
 }
+
+// BatchDelete deletes the fids from the volume server by one request,
+// the volume server deletes its own copies only, not the replicas.
+func (c *Client) BatchDelete(ctx context.Context, server string, fileIds []string) ([]DeleteResult, error) {
+	values := make(url.Values)
+	for _, fid := range fileIds {
+		values.Add("fid", fid)
+	}
+	jsonBlob, err := c.Post(ctx, fmt.Sprintf("http://%s/delete", server), values)
+	if err != nil {
+		return nil, err
+	}
+	var result []DeleteResult
+	if err = json.Unmarshal(jsonBlob, &result); err != nil {
+		return nil, &ServerError{Url: fmt.Sprintf("http://%s/delete", server), Message: fmt.Sprintf("%v %s", err, jsonBlob)}
+	}
+
+	return result, nil
+}
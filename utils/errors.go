@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// The kinds of failures, tell them apart by errors.Is. The errors returned
+// wrap them with the details, e.g. *ServerError and *ChecksumError.
+var (
+	ErrNotFound          = errors.New("not found")
+	ErrNoWritableVolumes = errors.New("no writable volumes")
+	ErrMasterUnavailable = errors.New("master unavailable")
+	ErrVolumeUnavailable = errors.New("volume server unavailable")
+	ErrInvalidFid        = errors.New("invalid fid")
+	ErrChecksumMismatch  = errors.New("checksum mismatch")
+	ErrPartialDelete     = errors.New("partial delete")
+)
+
+// ServerError is a failed request to a master or a volume server,
+// either an error response or no response at all.
+type ServerError struct {
+	Url        string
+	Master     bool   // requested a master, otherwise a volume server.
+	StatusCode int    // 0 if no response.
+	Message    string // the error reported by the server.
+	Err        error  // the transport error if no response.
+}
+
+func (e *ServerError) Error() string {
+	switch {
+	case e.Err != nil:
+		return e.Err.Error()
+	case e.StatusCode == 0:
+		return fmt.Sprintf("%s: %s", e.Url, e.Message)
+	case e.Message != "":
+		return fmt.Sprintf("%s: %d %s", e.Url, e.StatusCode, e.Message)
+	default:
+		return fmt.Sprintf("%s: %d %s", e.Url, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// Is maps the error onto the kinds of failures.
+func (e *ServerError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrNoWritableVolumes:
+		msg := strings.ToLower(e.Message)
+		return e.Master && (strings.Contains(msg, "no writable volume") || strings.Contains(msg, "no free volume"))
+	case ErrMasterUnavailable:
+		return e.Master && e.unavailable()
+	case ErrVolumeUnavailable:
+		return !e.Master && e.unavailable()
+	}
+	return false
+}
+
+// unavailable tells the server failed to serve, not the caller gave up.
+func (e *ServerError) unavailable() bool {
+	if e.Err != nil {
+		return !errors.Is(e.Err, context.Canceled) && !errors.Is(e.Err, context.DeadlineExceeded)
+	}
+	return e.StatusCode >= http.StatusInternalServerError
+}
+
+// StatusError returns the error of the response of url with an unexpected
+// status, the message is read from the body if it is not closed yet.
+func StatusError(url string, resp *http.Response) *ServerError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	return responseError(url, resp.StatusCode, body)
+}
+
+// responseError returns the error of an error response, the message is
+// the error field of a json body, or the body itself.
+func responseError(url string, statusCode int, body []byte) *ServerError {
+	e := &ServerError{Url: url, StatusCode: statusCode}
+	var m struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &m); err == nil {
+		e.Message = m.Error
+	} else {
+		e.Message = strings.TrimSpace(string(body))
+	}
+	return e
+}
+
+// transportError returns the error of a request to url got no response.
+func transportError(url string, err error) error {
+	return &ServerError{Url: url, Err: err}
+}
+
+// masterError marks the server error as of a master.
+func masterError(err error) error {
+	var se *ServerError
+	if errors.As(err, &se) {
+		se.Master = true
+	}
+	return err
+}
+
+// PartialDeleteError reports the fids of a file or a batch not all deleted.
+type PartialDeleteError struct {
+	Fid    string  // the file, empty for a batch.
+	Total  int     // number of fids to delete.
+	Failed []error // the failures, one per fid not deleted.
+}
+
+func (e *PartialDeleteError) Error() string {
+	msg := fmt.Sprintf("partial delete, %d of %d not deleted", len(e.Failed), e.Total)
+	if e.Fid != "" {
+		msg = fmt.Sprintf("partial delete of %s, %d of %d not deleted", e.Fid, len(e.Failed), e.Total)
+	}
+	if len(e.Failed) > 0 {
+		msg += ": " + e.Failed[0].Error()
+	}
+	return msg
+}
+
+func (e *PartialDeleteError) Is(target error) bool {
+	return target == ErrPartialDelete
+}
+
+// errorList is the failures of the same operation on several servers,
+// it is any of them by errors.Is and errors.As.
+type errorList []error
+
+// JoinErrors returns nil, the only error, or the list of errs.
+func JoinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return errorList(errs)
+}
+
+func (l errorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, err := range l {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
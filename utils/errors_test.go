@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestServerError(t *testing.T) {
+	tests := []struct {
+		err    *ServerError
+		target error
+		is     bool
+	}{
+		{&ServerError{StatusCode: http.StatusNotFound}, ErrNotFound, true},
+		{&ServerError{StatusCode: http.StatusOK, Master: true, Message: "No writable volumes in DataCenter dc1"}, ErrNoWritableVolumes, true},
+		{&ServerError{StatusCode: http.StatusOK, Message: "No writable volumes"}, ErrNoWritableVolumes, false},
+		{&ServerError{Master: true, Err: errors.New("connection refused")}, ErrMasterUnavailable, true},
+		{&ServerError{Master: true, Err: context.Canceled}, ErrMasterUnavailable, false},
+		{&ServerError{StatusCode: http.StatusServiceUnavailable}, ErrVolumeUnavailable, true},
+		{&ServerError{StatusCode: http.StatusServiceUnavailable}, ErrMasterUnavailable, false},
+		{&ServerError{StatusCode: http.StatusBadRequest}, ErrVolumeUnavailable, false},
+	}
+	for _, test := range tests {
+		if is := errors.Is(fmt.Errorf("wrapped: %w", test.err), test.target); is != test.is {
+			t.Errorf("Expect errors.Is(%v, %v) %t, but %t", test.err, test.target, test.is, is)
+		}
+	}
+}
+
+func TestJoinErrors(t *testing.T) {
+	if JoinErrors(nil) != nil {
+		t.Error("Expect nil of no errors")
+	}
+	notFound := &ServerError{Url: "a", StatusCode: http.StatusNotFound}
+	if JoinErrors([]error{notFound}) != notFound {
+		t.Error("Expect the only error")
+	}
+
+	err := JoinErrors([]error{errors.New("timeout"), notFound})
+	var se *ServerError
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &se) || se != notFound {
+		t.Errorf("Expect any of the errors, but %v", err)
+	}
+	if errors.Is(err, ErrVolumeUnavailable) {
+		t.Errorf("Expect not unavailable, but %v", err)
+	}
+}
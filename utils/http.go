@@ -1,7 +1,7 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -16,48 +16,128 @@ const (
 )
 
 var (
-	client *http.Client
+	defaultClient *Client
 )
 
 func init() {
 	transport := &http.Transport{
 		MaxIdleConnsPerHost: MAXIDLECONNSPERHOST,
 	}
-	client = &http.Client{Transport: transport}
+	defaultClient = NewClient(transport, &vc)
+}
+
+// Client issues the requests to the masters and volume servers
+// through its own transport and volume location cache.
+// The package level functions use a default client.
+type Client struct {
+	hc    *http.Client
+	vc    *VidCache
+	retry RetryPolicies
+	addr  AddressPolicy
+}
+
+// NewClient returns a Client with the given transport and cache,
+// a nil transport means http.DefaultTransport and a nil cache
+// means a cache of its own.
+func NewClient(transport http.RoundTripper, cache *VidCache) *Client {
+	if cache == nil {
+		cache = &VidCache{}
+	}
+	return &Client{
+		hc: &http.Client{Transport: transport},
+		vc: cache,
+	}
+}
+
+// DefaultClient returns the client used by the package level functions.
+func DefaultClient() *Client {
+	return defaultClient
 }
 
 func PostBytes(url, contentType string, body io.Reader) ([]byte, error) {
-	r, err := client.Post(url, contentType, body)
+	return PostBytesContext(context.Background(), url, contentType, body)
+}
+
+// PostBytesContext is like PostBytes but the request is bound to ctx.
+func PostBytesContext(ctx context.Context, url, contentType string, body io.Reader) ([]byte, error) {
+	return defaultClient.PostBytes(ctx, url, contentType, body)
+}
+
+func (c *Client) PostBytes(ctx context.Context, url, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, body)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Body.Close()
+	req.Header.Set("Content-Type", contentType)
 
-	return ReadAllHandler(r)
-}
+	r, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, transportError(url, err)
+	}
+	defer r.Body.Close()
 
-func Post(url string, values url.Values) ([]byte, error) {
-	r, err := client.PostForm(url, values)
+	respBody, err := ReadAllHandler(r)
 	if err != nil {
 		return nil, err
 	}
-	defer r.Body.Close()
+	if r.StatusCode >= http.StatusMultipleChoices {
+		return nil, responseError(url, r.StatusCode, respBody)
+	}
+
+	return respBody, nil
+}
+
+func Post(url string, values url.Values) ([]byte, error) {
+	return PostContext(context.Background(), url, values)
+}
 
-	return ReadAllHandler(r)
+// PostContext is like Post but the request is bound to ctx.
+func PostContext(ctx context.Context, url string, values url.Values) ([]byte, error) {
+	return defaultClient.Post(ctx, url, values)
+}
+
+func (c *Client) Post(ctx context.Context, url string, values url.Values) ([]byte, error) {
+	return c.PostBytes(ctx, url, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
 }
 
 func Get(url string) ([]byte, error) {
-	r, err := client.Get(url)
+	return GetContext(context.Background(), url)
+}
+
+// GetContext is like Get but the request is bound to ctx.
+func GetContext(ctx context.Context, url string) ([]byte, error) {
+	return defaultClient.Get(ctx, url)
+}
+
+func (c *Client) Get(ctx context.Context, url string) (b []byte, err error) {
+	err = c.RetryPolicy(OpDownload).Do(ctx, OpDownload, func() (err error) {
+		b, err = c.get(ctx, url)
+		return
+	})
+	return
+}
+
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
+
+	r, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, transportError(url, err)
+	}
 	defer r.Body.Close()
 
 	if r.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s: %s", url, r.Status)
+		return nil, StatusError(url, r)
 	}
 
-	return ReadAllHandler(r)
+	b, err := ReadAllHandler(r)
+	if err != nil {
+		return nil, transportError(url, err) // broken halfway, may retry.
+	}
+	return b, nil
 }
 
 func ReadAllHandler(r *http.Response) ([]byte, error) {
@@ -70,14 +150,29 @@ func ReadAllHandler(r *http.Response) ([]byte, error) {
 }
 
 func Delete(url string) error {
+	return DeleteContext(context.Background(), url)
+}
+
+// DeleteContext is like Delete but the request is bound to ctx.
+func DeleteContext(ctx context.Context, url string) error {
+	return defaultClient.Delete(ctx, url)
+}
+
+func (c *Client) Delete(ctx context.Context, url string) error {
+	return c.RetryPolicy(OpDelete).Do(ctx, OpDelete, func() error {
+		return c.delete(ctx, url)
+	})
+}
+
+func (c *Client) delete(ctx context.Context, url string) error {
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return err
 	}
 
-	resp, err := client.Do(req)
+	resp, err := c.hc.Do(req.WithContext(ctx))
 	if err != nil {
-		return err
+		return transportError(url, err)
 	}
 	defer resp.Body.Close()
 
@@ -90,21 +185,12 @@ func Delete(url string) error {
 	case http.StatusNotFound, http.StatusAccepted, http.StatusOK:
 		return nil
 	}
-	// The following code will return error:
-	// If we can unmarshal the error information from the response,
-	// then return the details.
-	m := make(map[string]interface{})
-	if err := json.Unmarshal(body, m); err == nil {
-		if s, ok := m["error"].(string); ok {
-			return errors.New(s)
-		}
-	}
-
-	return errors.New(string(body))
+	// The error with the details in the response if any.
+	return responseError(url, resp.StatusCode, body)
 }
 
 func GetBufferStream(url string, values url.Values, allocatedBytes []byte, eachBuffer func([]byte)) error {
-	r, err := client.PostForm(url, values)
+	r, err := defaultClient.hc.PostForm(url, values)
 	if err != nil {
 		return err
 	}
@@ -130,7 +216,7 @@ func GetBufferStream(url string, values url.Values, allocatedBytes []byte, eachB
 }
 
 func GetUrlStream(url string, values url.Values, readFn func(io.Reader) error) error {
-	r, err := client.PostForm(url, values)
+	r, err := defaultClient.hc.PostForm(url, values)
 	if err != nil {
 		return err
 	}
@@ -144,16 +230,47 @@ func GetUrlStream(url string, values url.Values, readFn func(io.Reader) error) e
 }
 
 func DownloadUrl(url string) (filename string, rc io.ReadCloser, e error) {
-	response, err := client.Get(url)
+	return DownloadUrlContext(context.Background(), url)
+}
+
+// DownloadUrlContext is like DownloadUrl but the request is bound to ctx,
+// cancelling ctx also aborts the reading of the returned body.
+func DownloadUrlContext(ctx context.Context, url string) (filename string, rc io.ReadCloser, e error) {
+	return defaultClient.DownloadUrl(ctx, url)
+}
+
+func (c *Client) DownloadUrl(ctx context.Context, url string) (filename string, rc io.ReadCloser, e error) {
+	e = c.RetryPolicy(OpDownload).Do(ctx, OpDownload, func() (err error) {
+		filename, rc, err = c.downloadUrl(ctx, url)
+		return
+	})
+	return
+}
+
+func (c *Client) downloadUrl(ctx context.Context, url string) (filename string, rc io.ReadCloser, e error) {
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", nil, err
 	}
+
+	response, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", nil, transportError(url, err)
+	}
 	if response.StatusCode != http.StatusOK {
-		response.Body.Close()
-		return "", nil, fmt.Errorf("%s: %s", url, response.Status)
+		defer response.Body.Close()
+		return "", nil, StatusError(url, response)
 	}
 
-	contentDisposition := response.Header["Content-Disposition"]
+	filename = FileNameOf(response.Header)
+	rc = response.Body
+
+	return
+}
+
+// FileNameOf returns the file name in the Content-Disposition header.
+func FileNameOf(h http.Header) (filename string) {
+	contentDisposition := h["Content-Disposition"]
 	if len(contentDisposition) > 0 {
 		idx := strings.Index(contentDisposition[0], "filename=")
 		if idx != -1 {
@@ -161,13 +278,123 @@ func DownloadUrl(url string) (filename string, rc io.ReadCloser, e error) {
 			filename = strings.Trim(filename, "\"")
 		}
 	}
-	rc = response.Body
 
 	return
 }
 
+// GetRange requests length bytes of the url from offset, negative length
+// means to the end. The body of the returned response always starts at
+// offset, even if the server ignores the Range header.
+// Returns io.EOF if offset is beyond the end.
+func (c *Client) GetRange(ctx context.Context, url string, offset, length int64) (resp *http.Response, err error) {
+	if length == 0 {
+		return nil, errors.New("empty range")
+	}
+	err = c.RetryPolicy(OpDownload).Do(ctx, OpDownload, func() (err error) {
+		resp, err = c.getRange(ctx, url, offset, length, false)
+		return
+	})
+	return
+}
+
+// GetRangeRaw is like GetRange, but a gzipped needle is read as stored,
+// the range is of the gzipped content.
+func (c *Client) GetRangeRaw(ctx context.Context, url string, offset, length int64) (resp *http.Response, err error) {
+	if length == 0 {
+		return nil, errors.New("empty range")
+	}
+	err = c.RetryPolicy(OpDownload).Do(ctx, OpDownload, func() (err error) {
+		resp, err = c.getRange(ctx, url, offset, length, true)
+		return
+	})
+	return
+}
+
+func (c *Client) getRange(ctx context.Context, url string, offset, length int64, raw bool) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if raw { // asked explicitly, the transport leaves the body as is.
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	if offset > 0 || length > 0 {
+		if length > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		} else {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		}
+	}
+
+	response, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, transportError(url, err)
+	}
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		if offset > 0 {
+			if _, err := io.CopyN(ioutil.Discard, response.Body, offset); err != nil {
+				response.Body.Close()
+				if err == io.EOF {
+					return nil, io.EOF
+				}
+				return nil, err
+			}
+		}
+		if length > 0 {
+			response.Body = &limitedReadCloser{io.LimitReader(response.Body, length), response.Body}
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		response.Body.Close()
+		return nil, io.EOF
+	default:
+		defer response.Body.Close()
+		return nil, StatusError(url, response)
+	}
+
+	return response, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Head requests the headers of the url, the body of the returned
+// response is closed already.
+func (c *Client) Head(ctx context.Context, url string) (resp *http.Response, err error) {
+	err = c.RetryPolicy(OpDownload).Do(ctx, OpDownload, func() (err error) {
+		resp, err = c.head(ctx, url)
+		return
+	})
+	return
+}
+
+func (c *Client) head(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, transportError(url, err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, &ServerError{Url: url, StatusCode: response.StatusCode}
+	}
+
+	return response, nil
+}
+
 func Do(req *http.Request) (resp *http.Response, err error) {
-	return client.Do(req)
+	return defaultClient.Do(req)
+}
+
+func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
+	return c.hc.Do(req)
 }
 
 func SanitizeUrl(url string) string {
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDownloadUrlContextCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, _, err := DownloadUrlContext(ctx, ts.URL); err == nil {
+		t.Fatal("Expect error when context deadline exceeded.")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Download not cancelled in time, elapse %v", time.Since(start))
+	}
+}
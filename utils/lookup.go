@@ -1,9 +1,10 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 )
@@ -24,14 +25,23 @@ func (lr *LookupResult) String() string {
 }
 
 var (
-	vc VidCache // Caching of volume locations, re-check if after 10 minutes.
+	vc VidCache // Caching of volume locations of the default client, re-check if after 10 minutes.
 )
 
 func Lookup(server string, vid string) (ret *LookupResult, err error) {
-	locations, cacheErr := vc.Get(vid)
+	return LookupContext(context.Background(), server, vid)
+}
+
+// LookupContext is like Lookup but the request to the master is bound to ctx.
+func LookupContext(ctx context.Context, server string, vid string) (ret *LookupResult, err error) {
+	return defaultClient.Lookup(ctx, server, vid)
+}
+
+func (c *Client) Lookup(ctx context.Context, server string, vid string) (ret *LookupResult, err error) {
+	locations, cacheErr := c.vc.Get(vid)
 	if cacheErr != nil {
-		if ret, err = doLookup(server, vid); err == nil {
-			vc.Set(vid, ret.Locations, EXPIRED_TIME)
+		if ret, err = c.doLookup(ctx, server, vid); err == nil {
+			c.vc.Set(vid, ret.Locations, EXPIRED_TIME)
 		}
 	} else {
 		ret = &LookupResult{VolumeId: vid, Locations: locations}
@@ -40,15 +50,16 @@ func Lookup(server string, vid string) (ret *LookupResult, err error) {
 	return
 }
 
-func doLookup(seeds string, vid string) (*LookupResult, error) {
+func (c *Client) doLookup(ctx context.Context, seeds string, vid string) (*LookupResult, error) {
 	values := make(url.Values)
 	values.Add("volumeId", vid)
 
 	var ret LookupResult
 	var jsonBlob []byte
 	var err error
-	err = RetryPost(seeds, func(seed string) error {
-		jsonBlob, err = Post(fmt.Sprintf("http://%s/dir/lookup", seed), values)
+	err = c.retryMasters(ctx, OpLookup, seeds, func(seed string) error {
+		lookupUrl := fmt.Sprintf("http://%s/dir/lookup", seed)
+		jsonBlob, err = c.Post(ctx, lookupUrl, values)
 		if err != nil {
 			return err
 		}
@@ -58,7 +69,7 @@ func doLookup(seeds string, vid string) (*LookupResult, error) {
 			return err
 		}
 		if ret.Error != "" {
-			return errors.New(ret.Error)
+			return &ServerError{Url: lookupUrl, StatusCode: http.StatusNotFound, Message: ret.Error}
 		}
 		return nil
 	})
@@ -71,17 +82,26 @@ func doLookup(seeds string, vid string) (*LookupResult, error) {
 }
 
 func LookupFileId(server string, fileId string) ([]Location, error) {
+	return LookupFileIdContext(context.Background(), server, fileId)
+}
+
+// LookupFileIdContext is like LookupFileId but the lookup is bound to ctx.
+func LookupFileIdContext(ctx context.Context, server string, fileId string) ([]Location, error) {
+	return defaultClient.LookupFileId(ctx, server, fileId)
+}
+
+func (c *Client) LookupFileId(ctx context.Context, server string, fileId string) ([]Location, error) {
 	parts := strings.Split(fileId, ",")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid fileId %s", fileId)
+		return nil, fmt.Errorf("%w %s", ErrInvalidFid, fileId)
 	}
 
-	lookup, err := Lookup(server, parts[0])
+	lookup, err := c.Lookup(ctx, server, parts[0])
 	if err != nil {
 		return nil, err
 	}
 	if len(lookup.Locations) == 0 {
-		return nil, fmt.Errorf("file not found for %s", fileId)
+		return nil, fmt.Errorf("file %s %w", fileId, ErrNotFound)
 	}
 
 	return lookup.Locations, nil
@@ -89,11 +109,20 @@ func LookupFileId(server string, fileId string) ([]Location, error) {
 
 // LookupVolumeIds find volume locations by cache and actual lookup
 func LookupVolumeIds(seeds string, vids []string) (map[string]LookupResult, error) {
+	return LookupVolumeIdsContext(context.Background(), seeds, vids)
+}
+
+// LookupVolumeIdsContext is like LookupVolumeIds but the lookup is bound to ctx.
+func LookupVolumeIdsContext(ctx context.Context, seeds string, vids []string) (map[string]LookupResult, error) {
+	return defaultClient.LookupVolumeIds(ctx, seeds, vids)
+}
+
+func (c *Client) LookupVolumeIds(ctx context.Context, seeds string, vids []string) (map[string]LookupResult, error) {
 	ret := make(map[string]LookupResult)
 	var unknownVids []string
 	//check vid cache first
 	for _, vid := range vids {
-		locations, cacheErr := vc.Get(vid)
+		locations, cacheErr := c.vc.Get(vid)
 		if cacheErr == nil {
 			ret[vid] = LookupResult{VolumeId: vid, Locations: locations}
 		} else {
@@ -113,8 +142,8 @@ func LookupVolumeIds(seeds string, vids []string) (map[string]LookupResult, erro
 
 	var jsonBlob []byte
 	var err error
-	err = RetryPost(seeds, func(seed string) error {
-		jsonBlob, err = Post(fmt.Sprintf("http://%s/vol/lookup", seed), values)
+	err = c.retryMasters(ctx, OpLookup, seeds, func(seed string) error {
+		jsonBlob, err = c.Post(ctx, fmt.Sprintf("http://%s/vol/lookup", seed), values)
 		if err != nil {
 			return err
 		}
@@ -130,17 +159,17 @@ func LookupVolumeIds(seeds string, vids []string) (map[string]LookupResult, erro
 	}
 
 	//set newly checked vids to cache
-	var errs []string
+	var errs []error
 	for _, vid := range unknownVids {
 		if ret[vid].Error != "" {
-			errs = append(errs, fmt.Sprintf("[%s]: %s", ret[vid].VolumeId, ret[vid].Error))
+			errs = append(errs, &ServerError{Master: true, StatusCode: http.StatusNotFound, Url: "volume " + vid, Message: ret[vid].Error})
 			continue
 		}
 		locations := ret[vid].Locations
-		vc.Set(vid, locations, EXPIRED_TIME)
+		c.vc.Set(vid, locations, EXPIRED_TIME)
 	}
 	if len(errs) > 0 {
-		return nil, errors.New(strings.Join(errs, "\n"))
+		return nil, JoinErrors(errs)
 	}
 
 	return ret, nil
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Op is the kind of request a retry policy applies to.
+type Op int
+
+const (
+	OpAssign   Op = iota // assign fids by a master.
+	OpLookup             // lookup volumes by a master.
+	OpUpload             // upload content to a volume server.
+	OpDownload           // GET or HEAD of a volume server.
+	OpDelete             // delete a fid from a volume server.
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpAssign:
+		return "assign"
+	case OpLookup:
+		return "lookup"
+	case OpUpload:
+		return "upload"
+	case OpDownload:
+		return "download"
+	case OpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Idempotent tells the request can be repeated once it may have reached
+// the server. An assign wastes fids and an upload may be half written,
+// so they are retried only if the server surely did nothing.
+func (op Op) Idempotent() bool {
+	return op != OpAssign && op != OpUpload
+}
+
+// RetryPolicy is how a failed request is retried, with the backoff
+// growing exponentially from InitialBackoff up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts is the max number of attempts including the first,
+	// 1 or less means never retry.
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration // 0 means no limit.
+	// Multiplier grows the backoff after each retry, less than 1 means 2.
+	Multiplier float64
+	// Jitter randomizes each backoff by up to the fraction of it,
+	// e.g. 0.2 is a backoff in [0.8, 1.2] of the computed one.
+	Jitter float64
+	// Budget is the time given to the operation, no retry is started
+	// after it elapsed since the first attempt. 0 means no limit.
+	Budget time.Duration
+}
+
+// RetryPolicies are the policies of the operations of a client.
+type RetryPolicies map[Op]*RetryPolicy
+
+var (
+	// DefaultRetryPolicy is of an operation without a policy of its own.
+	DefaultRetryPolicy = &RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Budget:         10 * time.Second,
+	}
+	// NoRetry tries once.
+	NoRetry = &RetryPolicy{MaxAttempts: 1}
+)
+
+// backoff returns the delay before the retry after attempt, counted from 1.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, fails not retryable for op, or the
+// attempts or the budget run out. It returns the last error of fn, or
+// the error of ctx if it is done while waiting to retry.
+func (p *RetryPolicy) Do(ctx context.Context, op Op, fn func() error) error {
+	var deadline time.Time
+	if p.Budget > 0 {
+		deadline = time.Now().Add(p.Budget)
+	}
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !Retryable(op, err) {
+			return err
+		}
+
+		backoff := p.backoff(attempt)
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		glog.V(4).Infof("Retry %s in %v after attempt %d, %v", op, backoff, attempt, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Retryable tells err of op is transient, so the request may succeed
+// if repeated. An idempotent op is retried if the server is unavailable,
+// the others only if the request was refused without any effect.
+func Retryable(op Op, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrNoWritableVolumes) || refused(err) {
+		return true
+	}
+	if !op.Idempotent() {
+		return false
+	}
+	return errors.Is(err, ErrMasterUnavailable) || errors.Is(err, ErrVolumeUnavailable)
+}
+
+// refused tells the request never reached the server, or the server
+// turned it away before handling it.
+func refused(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var se *ServerError
+	if errors.As(err, &se) {
+		return se.StatusCode == http.StatusServiceUnavailable || se.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// SetRetryPolicies sets the policies of the operations, an operation
+// missing uses DefaultRetryPolicy. It should be called before the client
+// is used.
+func (c *Client) SetRetryPolicies(policies RetryPolicies) {
+	c.retry = policies
+}
+
+// RetryPolicy returns the policy of op.
+func (c *Client) RetryPolicy(op Op) *RetryPolicy {
+	if p := c.retry[op]; p != nil {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+// retryMasters tries fn against the seeds in turn, and tries all of them
+// again by the policy of op if none succeeds.
+func (c *Client) retryMasters(ctx context.Context, op Op, seeds string, fn func(seed string) error) error {
+	return c.RetryPolicy(op).Do(ctx, op, func() error {
+		return RetryPostContext(ctx, seeds, fn)
+	})
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 4, InitialBackoff: time.Millisecond, MaxBackoff: 3 * time.Millisecond}
+	unavailable := &ServerError{StatusCode: http.StatusBadGateway}
+
+	attempts := 0
+	err := p.Do(context.Background(), OpDownload, func() error {
+		attempts++
+		return unavailable
+	})
+	if err != unavailable || attempts != 4 {
+		t.Errorf("Expect 4 attempts, but %d, %v", attempts, err)
+	}
+
+	attempts = 0
+	p.Do(context.Background(), OpUpload, func() error {
+		attempts++
+		return unavailable
+	})
+	if attempts != 1 {
+		t.Errorf("Expect an upload not retried after reaching the server, but %d attempts", attempts)
+	}
+
+	attempts = 0
+	p.Do(context.Background(), OpAssign, func() error {
+		attempts++
+		return &ServerError{Master: true, StatusCode: http.StatusOK, Message: "No writable volumes"}
+	})
+	if attempts != 4 {
+		t.Errorf("Expect an assign retried without writable volumes, but %d attempts", attempts)
+	}
+
+	attempts = 0
+	p.Do(context.Background(), OpDownload, func() error {
+		attempts++
+		return &ServerError{StatusCode: http.StatusNotFound}
+	})
+	if attempts != 1 {
+		t.Errorf("Expect not found never retried, but %d attempts", attempts)
+	}
+
+	if d := p.backoff(10); d != 3*time.Millisecond {
+		t.Errorf("Expect backoff capped at 3ms, but %v", d)
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 500*time.Microsecond || d > 1500*time.Microsecond {
+			t.Fatalf("Expect backoff in [0.5ms, 1.5ms], but %v", d)
+		}
+	}
+
+	p = &RetryPolicy{MaxAttempts: 100, InitialBackoff: 20 * time.Millisecond, Budget: 50 * time.Millisecond}
+	attempts = 0
+	p.Do(context.Background(), OpDownload, func() error {
+		attempts++
+		return unavailable
+	})
+	if attempts != 2 {
+		t.Errorf("Expect the budget to allow 2 attempts, but %d", attempts)
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(file)
+		json.NewEncoder(w).Encode(UploadResult{Size: uint32(len(b))})
+	}))
+	defer ts.Close()
+
+	c := NewClient(nil, nil)
+	c.SetRetryPolicies(RetryPolicies{OpUpload: {MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	ret, err := c.Upload(context.Background(), ts.URL, "a.txt", bytes.NewReader(data), false, "")
+	if err != nil || ret.Size != uint32(len(data)) || requests != 2 {
+		t.Fatalf("Expect uploaded by the retry, but %d requests, %v", requests, err)
+	}
+
+	// not rewindable, never retried.
+	atomic.StoreInt32(&requests, 0)
+	_, err = c.Upload(context.Background(), ts.URL, "a.txt", ioutil.NopCloser(bytes.NewReader(data)), false, "")
+	if !errors.Is(err, ErrVolumeUnavailable) || requests != 1 {
+		t.Errorf("Expect no retry of a stream, but %d requests, %v", requests, err)
+	}
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Placement is where a volume server is in the topology of the cluster.
+type Placement struct {
+	DataCenter string
+	Rack       string
+}
+
+// Topology maps the address of a volume server, url or public url,
+// to its placement.
+type Topology map[string]Placement
+
+// dirStatus is the part of the response of /dir/status of a master.
+type dirStatus struct {
+	Topology struct {
+		DataCenters []struct {
+			Id    string
+			Racks []struct {
+				Id        string
+				DataNodes []struct {
+					Url       string
+					PublicUrl string
+				}
+			}
+		}
+	}
+	Error string `json:"error,omitempty"`
+}
+
+// FetchTopology returns the topology of the cluster by /dir/status.
+func FetchTopology(seeds string) (Topology, error) {
+	return FetchTopologyContext(context.Background(), seeds)
+}
+
+// FetchTopologyContext is like FetchTopology but the request is bound to ctx.
+func FetchTopologyContext(ctx context.Context, seeds string) (Topology, error) {
+	return defaultClient.FetchTopology(ctx, seeds)
+}
+
+func (c *Client) FetchTopology(ctx context.Context, seeds string) (Topology, error) {
+	var status dirStatus
+	err := c.retryMasters(ctx, OpLookup, seeds, func(seed string) error {
+		statusUrl := fmt.Sprintf("http://%s/dir/status", seed)
+		jsonBlob, err := c.get(ctx, statusUrl)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(jsonBlob, &status); err != nil {
+			return err
+		}
+		if status.Error != "" {
+			return &ServerError{Url: statusUrl, StatusCode: http.StatusOK, Message: status.Error}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	topo := make(Topology)
+	for _, dc := range status.Topology.DataCenters {
+		for _, rack := range dc.Racks {
+			for _, node := range rack.DataNodes {
+				p := Placement{DataCenter: dc.Id, Rack: rack.Id}
+				topo[node.Url] = p
+				if node.PublicUrl != "" {
+					topo[node.PublicUrl] = p
+				}
+			}
+		}
+	}
+
+	return topo, nil
+}
+
+// distance tells how far the location is from the placement, 0 on the
+// same rack, 1 in the same data center, 2 otherwise or unknown.
+func (t Topology) distance(location Location, near Placement) int {
+	p, ok := t[location.Url]
+	if !ok {
+		p, ok = t[location.PublicUrl]
+	}
+	switch {
+	case !ok || near.DataCenter == "" || p.DataCenter != near.DataCenter:
+		return 2
+	case near.Rack != "" && p.Rack == near.Rack:
+		return 0
+	}
+	return 1
+}
+
+// Rank returns a copy of the locations ordered by the distance from near,
+// the same rack first, then the same data center, then the others, the
+// order of the locations as far is kept.
+func (t Topology) Rank(locations []Location, near Placement) []Location {
+	ranked := append([]Location(nil), locations...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return t.distance(ranked[i], near) < t.distance(ranked[j], near)
+	})
+	return ranked
+}
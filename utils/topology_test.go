@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFetchTopology(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Topology":{"DataCenters":[
+			{"Id":"dc1","Racks":[{"Id":"r1","DataNodes":[{"Url":"10.0.0.1:8080","PublicUrl":"v1:8080"}]},
+				{"Id":"r2","DataNodes":[{"Url":"10.0.0.2:8080","PublicUrl":"10.0.0.2:8080"}]}]},
+			{"Id":"dc2","Racks":[{"Id":"r1","DataNodes":[{"Url":"10.1.0.1:8080"}]}]}]},
+			"Version":"0.76"}`))
+	}))
+	defer ts.Close()
+
+	topo, err := NewClient(nil, nil).FetchTopology(context.Background(), strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to fetch topology: %v", err)
+	}
+	expected := Topology{
+		"10.0.0.1:8080": {"dc1", "r1"},
+		"v1:8080":       {"dc1", "r1"},
+		"10.0.0.2:8080": {"dc1", "r2"},
+		"10.1.0.1:8080": {"dc2", "r1"},
+	}
+	if !reflect.DeepEqual(topo, expected) {
+		t.Errorf("Expect %v, but %v", expected, topo)
+	}
+}
+
+func TestRankLocations(t *testing.T) {
+	topo := Topology{
+		"a": {"dc1", "r1"},
+		"b": {"dc1", "r2"},
+		"c": {"dc2", "r1"},
+		"d": {"dc1", "r2"},
+	}
+	locations := []Location{{Url: "x"}, {Url: "c"}, {Url: "b"}, {Url: "a"}, {Url: "d"}}
+
+	ranked := topo.Rank(locations, Placement{DataCenter: "dc1", Rack: "r2"})
+	var urls []string
+	for _, l := range ranked {
+		urls = append(urls, l.Url)
+	}
+	if got := strings.Join(urls, ","); got != "b,d,a,x,c" {
+		t.Errorf("Expect b,d,a,x,c, but %s", got)
+	}
+	if locations[0].Url != "x" {
+		t.Error("Expect the locations not modified")
+	}
+}
@@ -6,6 +6,27 @@ import (
 	"strings"
 )
 
+// ValidateTTL checks the ttl in the SeaweedFS format, a count
+// in [1, 255] followed by a unit of m, h, d, w, M or y,
+// a count without unit is minutes. Empty ttl means never expire.
+func ValidateTTL(ttlString string) error {
+	if ttlString == "" {
+		return nil
+	}
+
+	countString := ttlString
+	switch ttlString[len(ttlString)-1] {
+	case 'm', 'h', 'd', 'w', 'M', 'y':
+		countString = ttlString[:len(ttlString)-1]
+	}
+	count, err := strconv.Atoi(countString)
+	if err != nil || count <= 0 || count > 255 {
+		return fmt.Errorf("invalid ttl %q", ttlString)
+	}
+
+	return nil
+}
+
 func AdjustTTL(ttlString string) string {
 	if ttlString == "" {
 		return ""
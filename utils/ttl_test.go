@@ -9,3 +9,16 @@ func Test(t *testing.T) {
 	t.Logf("ttl 50h adjust to %s", AdjustTTL("50h"))
 	t.Logf("ttl 180d adjust to %s", AdjustTTL("180d"))
 }
+
+func TestValidateTTL(t *testing.T) {
+	for _, ttl := range []string{"", "3m", "50h", "180d", "26w", "6M", "1y", "15"} {
+		if err := ValidateTTL(ttl); err != nil {
+			t.Errorf("ttl %q expect valid, but %v", ttl, err)
+		}
+	}
+	for _, ttl := range []string{"m", "0d", "256d", "3s", "-1h", "1.5h"} {
+		if err := ValidateTTL(ttl); err == nil {
+			t.Errorf("ttl %q expect invalid", ttl)
+		}
+	}
+}
@@ -2,12 +2,13 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
 	"path/filepath"
 	"strings"
@@ -19,17 +20,87 @@ type UploadResult struct {
 	Error string `json:"error,omitempty"`
 }
 
+// SizeHeader is the needle pair carrying the size of the content of a
+// needle compressed by the client, before compression.
+const SizeHeader = "Seaweed-Size"
+
 var fileNameEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
 
 func Upload(uploadUrl string, filename string, reader io.Reader, isGzipped bool, mtype string) (*UploadResult, error) {
-	return uploadContent(uploadUrl, func(w io.Writer) (err error) {
+	return UploadContext(context.Background(), uploadUrl, filename, reader, isGzipped, mtype)
+}
+
+// UploadContext is like Upload but the request is bound to ctx.
+func UploadContext(ctx context.Context, uploadUrl string, filename string, reader io.Reader, isGzipped bool, mtype string) (*UploadResult, error) {
+	return defaultClient.Upload(ctx, uploadUrl, filename, reader, isGzipped, mtype)
+}
+
+func (c *Client) Upload(ctx context.Context, uploadUrl string, filename string, reader io.Reader, isGzipped bool, mtype string) (*UploadResult, error) {
+	return c.UploadWithOptions(ctx, uploadUrl, filename, reader, isGzipped, mtype, nil)
+}
+
+// UploadOptions are the optional arguments of an upload.
+type UploadOptions struct {
+	// Size of the content if known, the request is sent with the
+	// Content-Length. Otherwise in chunked transfer encoding, unless
+	// the reader tells its length like bytes.Reader.
+	Size int64
+	// Header is added to the request, e.g. the Seaweed- pairs.
+	Header http.Header
+}
+
+// UploadWithOptions is like Upload, the content is streamed to the volume
+// server without buffering in memory. The upload is retried by the policy
+// of OpUpload only if the reader is an io.Seeker, rewound for each attempt.
+func (c *Client) UploadWithOptions(ctx context.Context, uploadUrl string, filename string, reader io.Reader, isGzipped bool, mtype string, opts *UploadOptions) (*UploadResult, error) {
+	var size int64 = -1
+	var header http.Header
+	if opts != nil {
+		if opts.Size > 0 {
+			size = opts.Size
+		}
+		header = opts.Header
+	}
+	if size < 0 {
+		if l, ok := reader.(interface {
+			Len() int
+		}); ok {
+			size = int64(l.Len())
+		}
+	}
+
+	fill := func(w io.Writer) (err error) {
 		_, err = io.Copy(w, reader)
 		return
-	}, filename, isGzipped, mtype)
+	}
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return c.uploadContent(ctx, uploadUrl, fill, size, filename, isGzipped, mtype, header)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret *UploadResult
+	attempts := 0
+	err = c.RetryPolicy(OpUpload).Do(ctx, OpUpload, func() (err error) {
+		if attempts++; attempts > 1 {
+			if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+				return
+			}
+		}
+		ret, err = c.uploadContent(ctx, uploadUrl, fill, size, filename, isGzipped, mtype, header)
+		return
+	})
+
+	return ret, err
 }
-func uploadContent(uploadUrl string, fillBufferFunction func(w io.Writer) error, filename string, isGzipped bool, mtype string) (*UploadResult, error) {
-	bodyBuf := bytes.NewBufferString("")
-	bodyWriter := multipart.NewWriter(bodyBuf)
+
+// uploadContent streams the multipart body through a pipe while
+// fillBufferFunction writes the content, size is the content size
+// or -1 if unknown.
+func (c *Client) uploadContent(ctx context.Context, uploadUrl string, fillBufferFunction func(w io.Writer) error, size int64, filename string, isGzipped bool, mtype string, header http.Header) (*UploadResult, error) {
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, fileNameEscaper.Replace(filename)))
 	if mtype == "" {
@@ -41,21 +112,55 @@ func uploadContent(uploadUrl string, fillBufferFunction func(w io.Writer) error,
 	if isGzipped {
 		h.Set("Content-Encoding", "gzip")
 	}
-	fileWriter, err := bodyWriter.CreatePart(h)
+
+	pr, pw := io.Pipe()
+	bodyWriter := multipart.NewWriter(pw)
+	contentLength := int64(-1)
+	if size >= 0 {
+		// The same multipart envelope written aside tells the body length.
+		var envelope bytes.Buffer
+		ew := multipart.NewWriter(&envelope)
+		ew.SetBoundary(bodyWriter.Boundary())
+		ew.CreatePart(h)
+		ew.Close()
+		contentLength = int64(envelope.Len()) + size
+	}
+
+	go func() {
+		fileWriter, err := bodyWriter.CreatePart(h)
+		if err == nil {
+			err = fillBufferFunction(fileWriter)
+		}
+		if err == nil {
+			err = bodyWriter.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequest("POST", uploadUrl, pr)
 	if err != nil {
+		pr.Close()
 		return nil, err
 	}
-	if err := fillBufferFunction(fileWriter); err != nil {
-		return nil, err
+	for k, v := range header {
+		req.Header[k] = v
 	}
-	contentType := bodyWriter.FormDataContentType()
-	if err := bodyWriter.Close(); err != nil {
-		return nil, err
+	req.Header.Set("Content-Type", bodyWriter.FormDataContentType())
+	req.ContentLength = contentLength
+
+	r, err := c.hc.Do(req.WithContext(ctx))
+	pr.Close() // stop the writer if the request failed.
+	if err != nil {
+		return nil, transportError(uploadUrl, err)
 	}
-	respBody, err := PostBytes(uploadUrl, contentType, bodyBuf)
+	defer r.Body.Close()
+	respBody, err := ReadAllHandler(r)
 	if err != nil {
 		return nil, err
 	}
+	if r.StatusCode >= http.StatusMultipleChoices {
+		return nil, responseError(uploadUrl, r.StatusCode, respBody)
+	}
 
 	var ret UploadResult
 	err = json.Unmarshal(respBody, &ret)
@@ -63,7 +168,7 @@ func uploadContent(uploadUrl string, fillBufferFunction func(w io.Writer) error,
 		return nil, err
 	}
 	if ret.Error != "" {
-		return nil, errors.New(ret.Error)
+		return nil, &ServerError{Url: uploadUrl, StatusCode: r.StatusCode, Message: ret.Error}
 	}
 
 	return &ret, nil
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadStreaming(t *testing.T) {
+	var contentLength int64
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received, _ = ioutil.ReadAll(file)
+		json.NewEncoder(w).Encode(UploadResult{Size: uint32(len(received))})
+	}))
+	defer ts.Close()
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	c := NewClient(nil, nil)
+
+	// size unknown, chunked transfer encoding.
+	_, err := c.Upload(context.Background(), ts.URL, "a.txt", io.MultiReader(bytes.NewReader(data)), false, "")
+	if err != nil || contentLength != -1 || !bytes.Equal(received, data) {
+		t.Fatalf("Chunked upload mismatch, content length %d, err %v", contentLength, err)
+	}
+
+	// size given, Content-Length set.
+	ret, err := c.UploadWithOptions(context.Background(), ts.URL, "a.txt", io.MultiReader(bytes.NewReader(data)), false, "", &UploadOptions{Size: int64(len(data))})
+	if err != nil || contentLength <= int64(len(data)) || !bytes.Equal(received, data) || ret.Size != uint32(len(data)) {
+		t.Fatalf("Sized upload mismatch, content length %d, err %v", contentLength, err)
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
@@ -147,10 +148,19 @@ func FakeBytes(fileSize int) []byte {
 }
 
 func RetryPost(seeds string, fn func(seed string) error) error {
+	return RetryPostContext(context.Background(), seeds, fn)
+}
+
+// RetryPostContext tries fn against every seed in turn until one succeeds,
+// it gives up as soon as ctx is done. The server errors are of masters.
+func RetryPostContext(ctx context.Context, seeds string, fn func(seed string) error) error {
 	servers := strings.Split(seeds, ",")
 	var err error
 	for _, server := range servers {
-		err = fn(server)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		err = masterError(fn(server))
 		if err != nil {
 			continue
 		}
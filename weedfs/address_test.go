@@ -0,0 +1,29 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestInternalAddress(t *testing.T) {
+	fc := newFakeCluster(t)
+	// the public url is unreachable from inside.
+	fc.replicas = []utils.Location{{Url: fc.addr(), PublicUrl: "127.0.0.1:1"}}
+	c := fc.client(t, Options{ChunkSize: 100, Address: utils.AddressPolicy{Internal: true}})
+	data := bytes.Repeat([]byte("internal"), 30)
+
+	fid := writeFile(t, c, &CreateOptions{Name: "a.bin"}, data)
+	if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+		t.Errorf("Expect %q, but %q", data, b)
+	}
+	report, err := c.RemoveWithOptions(context.Background(), fid, nil)
+	if err != nil || !report.Removed || len(report.Chunks) != 3 {
+		t.Errorf("Expect removed with its chunks, but %s, %v", report, err)
+	}
+	if len(fc.needles) != 0 {
+		t.Errorf("Expect every needle removed, but %d left", len(fc.needles))
+	}
+}
@@ -0,0 +1,120 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func readFile(t *testing.T, c *Client, fid string) []byte {
+	f, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+	return b
+}
+
+func TestOpenAppend(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000})
+	data := bytes.Repeat([]byte("0123456789"), 400)
+
+	for name, tc := range map[string]struct {
+		chunkSize int64
+		chunks    int
+	}{
+		"plain":   {10000, 4}, // converted to 4 chunks.
+		"chunked": {1000, 5},  // 2 chunks appended.
+	} {
+		fid := writeFile(t, c, &CreateOptions{Name: "a.log", ChunkSize: tc.chunkSize}, data[:2500])
+
+		f, err := c.OpenAppend(fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to open append: %v", name, err)
+		}
+		if f.Size+int64(f.buf.Len()) != 2500 || f.RealName != "a.log" {
+			t.Errorf("%s: Expect a.log appended from 2500, but %s from %d", name, f, f.Size+int64(f.buf.Len()))
+		}
+		f.Write(data[2500:])
+		if err := f.Close(); err != nil {
+			t.Fatalf("%s: Failed to close: %v", name, err)
+		}
+
+		if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+			t.Errorf("%s: Appended file mismatch, %d bytes", name, len(b))
+		}
+		fi, err := c.Stat(fid, 1)
+		if err != nil || !fi.Chunked || fi.Chunks != tc.chunks {
+			t.Errorf("%s: Expect %d chunks, but %s, %v", name, tc.chunks, fi, err)
+		}
+	}
+}
+
+func TestResumeAppend(t *testing.T) {
+	fc := newFakeCluster(t)
+	dir, err := ioutil.TempDir("", "append")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := fc.client(t, Options{ChunkSize: 100, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.log"}, data[:250])
+
+	f, err := c.OpenAppendContext(context.Background(), fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open append: %v", err)
+	}
+	f.Write(data[250:500])
+	f.waitChunks() // the process dies without Close.
+
+	report, err := c.Sweep(context.Background(), SweepOptions{DryRun: true})
+	if err != nil || len(report.Reclaimed) != 2 {
+		t.Errorf("Expect only the 2 chunks appended to sweep, but %v, %v", report, err)
+	}
+
+	r, err := c.Resume(context.Background(), fid)
+	if err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if r.Size != 450 || r.base != 3 {
+		t.Fatalf("Expect resumed from 450 after 3 base chunks, but %d, %d", r.Size, r.base)
+	}
+	r.Write(data[r.Size:])
+	if err := r.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+		t.Errorf("Resumed file mismatch, %d bytes", len(b))
+	}
+
+	// dies before the first chunk appended is uploaded.
+	fid = writeFile(t, c, &CreateOptions{Name: "b.log"}, data[:250])
+	f, err = c.OpenAppendContext(context.Background(), fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open append: %v", err)
+	}
+	f.Write(data[250:260])
+
+	r, err = c.Resume(context.Background(), fid)
+	if err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if r.Size != 250 || r.base != 3 {
+		t.Fatalf("Expect resumed from 250 after 3 base chunks, but %d, %d", r.Size, r.base)
+	}
+	r.Write(data[r.Size:300]) // less than a chunk.
+	if err := r.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if b := readFile(t, c, fid); !bytes.Equal(b, data[:300]) {
+		t.Errorf("Resumed file mismatch, %d bytes", len(b))
+	}
+}
@@ -0,0 +1,156 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+const DEFAULT_BATCH_CONCURRENCY = 8
+
+// BatchItem is a small file of a batch upload.
+type BatchItem struct {
+	Name     string
+	Data     []byte
+	MimeType string // detected by the name extension if empty.
+	Gzipped  bool   // the data is gzipped already, detected by .gz extension too.
+}
+
+// BatchResult is the result of the item of the same index.
+type BatchResult struct {
+	Fid   string
+	Size  int64
+	Error error
+}
+
+// BatchOptions specifies a batch upload, the placement and TTL of the
+// files are taken from CreateOptions, the other fields are ignored.
+type BatchOptions struct {
+	CreateOptions
+	// Concurrency is the max number of files uploading concurrently,
+	// 0 means DEFAULT_BATCH_CONCURRENCY.
+	Concurrency int
+}
+
+// UploadBatch uploads many small files, each as a single needle. The fids
+// are reserved in bulk by the assign count, fid, fid_1, fid_2..., so the
+// files of an assign go to the same volume server. It returns a result
+// per item, the error is only for invalid options.
+func (c *Client) UploadBatch(ctx context.Context, items []*BatchItem, opts *BatchOptions) ([]*BatchResult, error) {
+	if opts == nil {
+		opts = &BatchOptions{}
+	}
+	if opts.Concurrency < 0 {
+		return nil, fmt.Errorf("invalid concurrency %d", opts.Concurrency)
+	}
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = DEFAULT_BATCH_CONCURRENCY
+	}
+	tmpl, err := c.newFile(ctx, &opts.CreateOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*BatchResult, len(items))
+	for i := range results {
+		results[i] = &BatchResult{}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for next := 0; next < len(items); {
+		ar := &utils.VolumeAssignRequest{
+			Count:       uint64(len(items) - next),
+			Replication: tmpl.replication,
+			Collection:  tmpl.collection,
+			DataCenter:  tmpl.dataCenter,
+			Rack:        tmpl.rack,
+			DataNode:    tmpl.dataNode,
+			Ttl:         tmpl.TTL,
+		}
+		aRet, err := c.uc.Assign(ctx, c.opts.Seeds, ar)
+		if err == nil && aRet.Count == 0 {
+			err = errors.New("no fid assigned")
+		}
+		if err != nil {
+			for ; next < len(items); next++ {
+				results[next].Error = err
+			}
+			break
+		}
+
+		for k := uint64(0); k < aRet.Count && next < len(items); k++ {
+			fid := aRet.Fid
+			if k > 0 {
+				fid = fmt.Sprintf("%s_%d", aRet.Fid, k)
+			}
+			results[next].Fid = fid
+
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(item *BatchItem, ret *BatchResult, fileUrl string) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				ret.Size, ret.Error = c.uploadItem(ctx, tmpl, item, ret.Fid, fileUrl)
+			}(items[next], results[next], c.uc.FileUrl(aRet.Location(), fid))
+			next++
+		}
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+// uploadItem uploads item to fileUrl of fid as a single needle.
+func (c *Client) uploadItem(ctx context.Context, tmpl *WeedFile, item *BatchItem, fid, fileUrl string) (int64, error) {
+	f := &WeedFile{Fid: fid}
+	f.setName(item.Name, item.MimeType, item.Gzipped)
+
+	data, gzipped := item.Data, f.IsGzipped
+	uopts := &utils.UploadOptions{Header: make(http.Header)}
+	if p := tmpl.compress; p != nil && c.opts.Keys == nil && !gzipped && p.matches(f.MimeType) && len(data) > 0 && p.worth(int64(len(data))) {
+		gz, err := p.gzipBytes(data)
+		if err != nil {
+			return 0, err
+		}
+		uopts.Header.Set(utils.SizeHeader, strconv.Itoa(len(data)))
+		uopts.Header.Set(utils.PlainMd5Header, utils.Md5Hex(data))
+		data, gzipped = gz, true
+	}
+	if c.opts.Keys != nil { // a data key per file.
+		key, err := newFileKey(ctx, c.opts.Keys, tmpl.domain)
+		if err != nil {
+			return 0, err
+		}
+		sealed, nonce, err := key.seal(data, 0)
+		if err != nil {
+			return 0, err
+		}
+		key.sealHeader(uopts.Header, nonce, len(data))
+		data, gzipped = sealed, false
+	}
+	uopts.Header.Set(utils.Md5Header, utils.Md5Hex(data))
+	ret, err := c.uc.UploadWithOptions(ctx, utils.SanitizeTTL(fileUrl, tmpl.TTL), f.FileName, bytes.NewReader(data), gzipped, f.MimeType, uopts)
+	if err != nil {
+		glog.Warningf("Failed to upload %s to %s, %v", f.RealName, fileUrl, err)
+		return 0, err
+	}
+
+	return int64(ret.Size), nil
+}
+
+// UploadBatch uploads many small files to the cluster of seeds, see Client.UploadBatch.
+func UploadBatch(ctx context.Context, seeds string, items []*BatchItem, opts *BatchOptions) ([]*BatchResult, error) {
+	return defaultClient(seeds, "", "", "").UploadBatch(ctx, items, opts)
+}
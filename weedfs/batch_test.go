@@ -0,0 +1,57 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUploadBatch(t *testing.T) {
+	fc := newFakeCluster(t)
+	fc.maxCount = 8
+	c := fc.client(t, Options{})
+
+	var items []*BatchItem
+	for i := 0; i < 20; i++ {
+		items = append(items, &BatchItem{
+			Name: fmt.Sprintf("thumb%d.png", i),
+			Data: bytes.Repeat([]byte{byte(i)}, 100+i),
+		})
+	}
+	results, err := c.UploadBatch(context.Background(), items, &BatchOptions{Concurrency: 4})
+	if err != nil {
+		t.Fatalf("Failed to upload batch: %v", err)
+	}
+	if fc.assigns != 3 {
+		t.Errorf("Expect 3 assigns for 20 items, but %d", fc.assigns)
+	}
+
+	seen := make(map[string]bool)
+	for i, ret := range results {
+		if ret.Error != nil {
+			t.Errorf("Failed to upload item %d: %v", i, ret.Error)
+			continue
+		}
+		if seen[ret.Fid] {
+			t.Errorf("Duplicated fid %s", ret.Fid)
+		}
+		seen[ret.Fid] = true
+		if i%8 != 0 && !strings.Contains(ret.Fid, "_") {
+			t.Errorf("Expect item %d a delta of the fid assigned, but %s", i, ret.Fid)
+		}
+
+		n := fc.needle(ret.Fid)
+		if n == nil || !bytes.Equal(n.data, items[i].Data) || n.name != items[i].Name || n.mime != "image/png" {
+			t.Errorf("Item %d mismatch, %+v", i, n)
+		}
+		if ret.Size != int64(len(items[i].Data)) {
+			t.Errorf("Expect item %d size %d, but %d", i, len(items[i].Data), ret.Size)
+		}
+	}
+
+	if _, err := c.UploadBatch(context.Background(), items, &BatchOptions{CreateOptions: CreateOptions{TTL: "x"}}); err == nil {
+		t.Error("Expect invalid options refused")
+	}
+}
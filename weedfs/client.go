@@ -0,0 +1,683 @@
+package weedfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// Options configures a Client.
+type Options struct {
+	Seeds       string // comma separated master addresses, required.
+	Replication string // replica strategy
+	DataCenter  string
+	Rack        string
+	Collection  string
+	TTL         string
+	ChunkSize   int64 // 0 means never split the file into chunks.
+	// InflightChunks is the max number of chunks of a file uploading
+	// concurrently, 0 means DEFAULT_INFLIGHT_CHUNKS.
+	InflightChunks int
+	// ReadAheadChunks enables reading chunked files by the client, the
+	// chunks are fetched from their own volume servers in parallel, at most
+	// ReadAheadChunks chunks are buffered, the one being read included.
+	// 0 leaves it to the volume server.
+	ReadAheadChunks int
+	// JournalDir enables the upload journal, every upload session is
+	// recorded in a file of the directory until the file is closed,
+	// so it can be resumed by Resume after the process dies.
+	JournalDir string
+
+	// Transport is used for every request to masters and volume servers,
+	// nil means http.DefaultTransport.
+	Transport http.RoundTripper
+	// LookupCache caches the volume locations, nil means a cache
+	// owned by the client.
+	LookupCache *utils.VidCache
+	// Compression is the default policy of the files created, nil means
+	// never compress.
+	Compression *CompressionPolicy
+	// Keys enables the encryption, every file created is encrypted by a
+	// data key of its own, wrapped by the key of its domain. A file
+	// encrypted is never compressed nor streamed. Nil means plaintext,
+	// the encrypted files can not be read either.
+	Keys KeyProvider
+
+	// Address chooses the address of the volume servers to request,
+	// the public url by default.
+	Address utils.AddressPolicy
+
+	// Locality reads the replica nearest to DataCenter and Rack first,
+	// on the same rack, then in the same data center, then the others.
+	Locality bool
+	// Topology maps the volume servers to their data centers and racks
+	// for Locality, nil means the topology of the master by /dir/status.
+	Topology utils.Topology
+
+	// HedgeDelay enables hedged reads, if a replica has not responded
+	// within the delay, the read is sent to the next replica as well and
+	// the first response wins. 0 disables it.
+	HedgeDelay time.Duration
+	// HedgePercentile, e.g. 0.95, takes the percentile of the recent
+	// latencies of a replica as its delay once there are enough samples,
+	// HedgeDelay is used before that. 0 always uses HedgeDelay.
+	HedgePercentile float64
+
+	// Retry are the retry policies by operation, an operation missing
+	// uses utils.DefaultRetryPolicy.
+	Retry utils.RetryPolicies
+}
+
+// Client accesses one SeaweedFS cluster, each client has its own
+// settings, transport and volume location cache.
+type Client struct {
+	opts    Options
+	uc      *utils.Client
+	latency *latencyStats // of the replicas for hedged reads.
+	topo    topologyCache // of the master for reads by locality.
+}
+
+// NewClient creates a client by the options.
+func NewClient(opts Options) (*Client, error) {
+	if opts.Seeds == "" {
+		return nil, errors.New("master seeds is required")
+	}
+	if opts.ChunkSize < 0 || opts.ChunkSize > MAX_CHUNK_SIZE {
+		return nil, fmt.Errorf("chunk size %d out of range [0, %d]", opts.ChunkSize, MAX_CHUNK_SIZE)
+	}
+	if opts.InflightChunks < 0 {
+		return nil, fmt.Errorf("invalid inflight chunks %d", opts.InflightChunks)
+	}
+	if opts.InflightChunks == 0 {
+		opts.InflightChunks = DEFAULT_INFLIGHT_CHUNKS
+	}
+	if opts.ReadAheadChunks < 0 {
+		return nil, fmt.Errorf("invalid read ahead chunks %d", opts.ReadAheadChunks)
+	}
+
+	if opts.Locality && opts.DataCenter == "" {
+		return nil, errors.New("locality needs the data center of the client")
+	}
+	if opts.HedgeDelay < 0 {
+		return nil, fmt.Errorf("invalid hedge delay %v", opts.HedgeDelay)
+	}
+	if opts.HedgePercentile < 0 || opts.HedgePercentile >= 1 {
+		return nil, fmt.Errorf("hedge percentile %v out of range [0, 1)", opts.HedgePercentile)
+	}
+
+	uc := utils.NewClient(opts.Transport, opts.LookupCache)
+	uc.SetRetryPolicies(opts.Retry)
+	uc.SetAddressPolicy(opts.Address)
+
+	return &Client{
+		opts:    opts,
+		uc:      uc,
+		latency: newLatencyStats(),
+	}, nil
+}
+
+// defaultClient returns a client configured by the command line flags,
+// it shares the transport and lookup cache of the utils package.
+func defaultClient(seeds, replication, dc, rack string) *Client {
+	if weedChunkSize > MAX_CHUNK_SIZE {
+		weedChunkSize = MAX_CHUNK_SIZE
+		glog.Warningf("weed-chunk-size is set too large, use %d instead.", MAX_CHUNK_SIZE)
+	}
+
+	return &Client{
+		opts: Options{
+			Seeds:       seeds,
+			Replication: replication,
+			DataCenter:  dc,
+			Rack:        rack,
+			TTL:         defaultTTL,
+			ChunkSize:   weedChunkSize,
+
+			InflightChunks: inflightChunks,
+		},
+		uc: utils.DefaultClient(),
+	}
+}
+
+// CreateOptions specifies the file to create, the zero value of
+// a field falls back to the client options.
+type CreateOptions struct {
+	Name        string
+	Domain      int64
+	Replication string
+	Collection  string
+	DataCenter  string
+	Rack        string
+	DataNode    string // pin the file to a volume server, host:port.
+	TTL         string
+	ChunkSize   int64  // negative means never split the file into chunks.
+	MimeType    string // detected by the name extension if empty.
+	Gzipped     bool   // the content is gzipped already, detected by .gz extension too.
+
+	InflightChunks int // max number of chunks uploading concurrently.
+
+	// Size of the content if known, a file never split is streamed
+	// with the Content-Length, otherwise in chunked transfer encoding.
+	Size int64
+
+	// Compression gzips the content of the mime types on upload,
+	// nil means the policy of the client.
+	Compression *CompressionPolicy
+}
+
+func (c *Client) validate(opts *CreateOptions) error {
+	if opts.ChunkSize > MAX_CHUNK_SIZE {
+		return fmt.Errorf("chunk size %d is larger than %d", opts.ChunkSize, MAX_CHUNK_SIZE)
+	}
+	if opts.Size < 0 {
+		return fmt.Errorf("invalid size %d", opts.Size)
+	}
+	if opts.InflightChunks < 0 {
+		return fmt.Errorf("invalid inflight chunks %d", opts.InflightChunks)
+	}
+	if p := opts.Compression; p != nil && (p.Level < gzip.HuffmanOnly || p.Level > gzip.BestCompression) {
+		return fmt.Errorf("invalid compression level %d", p.Level)
+	}
+	if err := utils.ValidateTTL(opts.TTL); err != nil {
+		return err
+	}
+	if opts.Replication != "" {
+		if len(opts.Replication) != 3 || strings.Trim(opts.Replication, "0123456789") != "" {
+			return fmt.Errorf("invalid replication %q", opts.Replication)
+		}
+	}
+
+	return nil
+}
+
+// Create creates a file for upload, see CreateContext.
+func (c *Client) Create(name string, domain int64) (*WeedFile, error) {
+	return c.CreateContext(context.Background(), name, domain)
+}
+
+// CreateContext assigns a fid and returns the file to write the content to,
+// the content is uploaded when the file is closed.
+func (c *Client) CreateContext(ctx context.Context, name string, domain int64) (*WeedFile, error) {
+	return c.CreateWithOptions(ctx, &CreateOptions{Name: name, Domain: domain})
+}
+
+// CreateWithOptions is like CreateContext but the file is specified by opts,
+// the options are validated before assigning the fid.
+func (c *Client) CreateWithOptions(ctx context.Context, opts *CreateOptions) (*WeedFile, error) {
+	if opts == nil {
+		opts = &CreateOptions{}
+	}
+	ret, err := c.newFile(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := &utils.VolumeAssignRequest{
+		Count:       1,
+		Replication: ret.replication,
+		Collection:  ret.collection,
+		DataCenter:  ret.dataCenter,
+		Rack:        ret.rack,
+		DataNode:    ret.dataNode,
+		Ttl:         ret.TTL,
+	}
+	aRet, err := c.uc.Assign(ctx, ret.seeds, ar)
+	if err != nil {
+		return nil, err
+	}
+	ret.Fid = aRet.Fid
+	ret.FileUrl = c.uc.FileUrl(aRet.Location(), aRet.Fid)
+
+	if err := c.begin(ret, opts.Name, opts.MimeType, opts.Gzipped); err != nil {
+		return nil, err
+	}
+	glog.V(4).Infof("Create seaweed file %s", ret)
+
+	return ret, nil
+}
+
+// Overwrite returns a file to write the new content of id to, see OverwriteContext.
+func (c *Client) Overwrite(id string, domain int64) (*WeedFile, error) {
+	return c.OverwriteContext(context.Background(), id, domain)
+}
+
+// OverwriteContext returns a file to write the new content of the existing
+// fid id to, the references to the fid stay valid.
+func (c *Client) OverwriteContext(ctx context.Context, id string, domain int64) (*WeedFile, error) {
+	return c.OverwriteWithOptions(ctx, id, &CreateOptions{Domain: domain})
+}
+
+// OverwriteWithOptions is like OverwriteContext but the new version is
+// specified by opts, the name of the old version is kept if opts.Name is
+// empty. The new content replaces the old one when the file is closed,
+// if the old version is chunked, its chunks are deleted after the new
+// version is committed.
+func (c *Client) OverwriteWithOptions(ctx context.Context, id string, opts *CreateOptions) (*WeedFile, error) {
+	ret, err := c.newFile(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, cm, locations, err := c.stat(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ret.Fid = id
+	ret.FileUrl = c.uc.FileUrl(locations[0], id)
+	if cm != nil {
+		for _, ci := range cm.Chunks {
+			ret.replaced = append(ret.replaced, ci.Fid)
+		}
+	}
+
+	name := opts.Name
+	if name == "" && fi.Name != id {
+		name = fi.Name
+	}
+	if err := c.begin(ret, name, opts.MimeType, opts.Gzipped); err != nil {
+		return nil, err
+	}
+	glog.V(4).Infof("Overwrite seaweed file %s, %d chunks replaced", ret, len(ret.replaced))
+
+	return ret, nil
+}
+
+// OpenAppend opens the file id to append to, see OpenAppendContext.
+func (c *Client) OpenAppend(id string, domain int64) (*WeedFile, error) {
+	return c.OpenAppendContext(context.Background(), id, domain)
+}
+
+// OpenAppendContext opens the existing file id to append to, the file is
+// bound to ctx.
+func (c *Client) OpenAppendContext(ctx context.Context, id string, domain int64) (*WeedFile, error) {
+	return c.OpenAppendWithOptions(ctx, id, &CreateOptions{Domain: domain})
+}
+
+// OpenAppendWithOptions opens the existing file id to append to, the data
+// written is uploaded as the chunks following the existing ones, and the
+// manifest is uploaded again when the file is closed, the readers see the
+// file extended at once. The existing chunks are never uploaded again nor
+// deleted if the append fails. A plain needle is converted to a chunked
+// file, its content is uploaded again as the first chunks. The name and
+// mime type of the file are kept, only one appender of a file at a time.
+func (c *Client) OpenAppendWithOptions(ctx context.Context, id string, opts *CreateOptions) (*WeedFile, error) {
+	ret, err := c.newFile(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if ret.chunkSize <= 0 {
+		return nil, errors.New("append needs a chunk size")
+	}
+
+	fi, cm, locations, err := c.stat(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsGzipped {
+		return nil, fmt.Errorf("can not append to gzipped file %s", id)
+	}
+	// The chunks appended are encrypted by the key of the file, a plain
+	// needle is converted by a new key, a plaintext chunked file stays so.
+	switch {
+	case cm != nil && cm.Key != nil:
+		ret.key, err = c.fileKey(ctx, ret.domain, cm.Key)
+	case cm == nil && c.opts.Keys != nil:
+		ret.key, err = newFileKey(ctx, c.opts.Keys, ret.domain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ret.Encrypted = ret.key != nil
+	ret.Fid = id
+	ret.FileUrl = c.uc.FileUrl(locations[0], id)
+	ret.FileName = id
+	if fi.Name != "" {
+		ret.FileName = fi.Name
+	}
+	ret.RealName = ret.FileName
+	ret.MimeType = fi.MimeType
+	ret.split = true // the manifest is uploaded even if nothing appended.
+	if cm != nil {
+		ret.chunkInfo = append(ret.chunkInfo, cm.Chunks...)
+		ret.base = len(cm.Chunks)
+		ret.Size = cm.Size
+		ret.md5 = nil // md5 of the whole file is unknown.
+	}
+	if c.opts.JournalDir != "" {
+		if ret.journal, err = createJournal(c.opts.JournalDir, ret); err != nil {
+			return nil, err
+		}
+	}
+
+	if cm == nil {
+		if err := c.convert(ctx, ret); err != nil {
+			ret.hasErr = true
+			ret.Close()
+			return nil, err
+		}
+	}
+	glog.V(4).Infof("Open seaweed file %s to append from %d", ret, ret.Size)
+
+	return ret, nil
+}
+
+// convert writes the content of the plain needle to f,
+// which becomes the first chunks of f.
+func (c *Client) convert(ctx context.Context, f *WeedFile) error {
+	r, err := c.OpenWithOptions(ctx, f.Fid, &OpenOptions{Domain: f.domain})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+// newFile returns a file to write by opts, not assigned yet.
+func (c *Client) newFile(ctx context.Context, opts *CreateOptions) (*WeedFile, error) {
+	o := *opts
+	if o.Replication == "" {
+		o.Replication = c.opts.Replication
+	}
+	if o.Collection == "" {
+		o.Collection = c.opts.Collection
+	}
+	if o.DataCenter == "" {
+		o.DataCenter = c.opts.DataCenter
+	}
+	if o.Rack == "" {
+		o.Rack = c.opts.Rack
+	}
+	if o.TTL == "" {
+		o.TTL = c.opts.TTL
+	}
+	if o.ChunkSize == 0 {
+		o.ChunkSize = c.opts.ChunkSize
+	} else if o.ChunkSize < 0 {
+		o.ChunkSize = 0
+	}
+	if o.InflightChunks == 0 {
+		o.InflightChunks = c.opts.InflightChunks
+	}
+	if o.Compression == nil {
+		o.Compression = c.opts.Compression
+	}
+	if err := c.validate(&o); err != nil {
+		return nil, err
+	}
+
+	ret := &WeedFile{
+		readFlag:    false,
+		client:      c,
+		seeds:       c.opts.Seeds,
+		replication: o.Replication,
+		collection:  o.Collection,
+		dataCenter:  o.DataCenter,
+		rack:        o.Rack,
+		dataNode:    o.DataNode,
+		chunkSize:   o.ChunkSize,
+		inflight:    o.InflightChunks,
+		expectSize:  o.Size,
+		Size:        0,
+		buf:         bytes.NewBuffer(nil),
+		split:       false,
+		hasErr:      false,
+		chunkInfo:   make([]*utils.ChunkInfo, 0),
+		md5:         md5.New(),
+		compress:    o.Compression,
+		domain:      o.Domain,
+		TTL:         o.TTL,
+		ctx:         ctx,
+	}
+
+	return ret, nil
+}
+
+// begin names the file of fid assigned and starts its upload session.
+func (c *Client) begin(ret *WeedFile, name, mimeType string, gzipped bool) error {
+	ret.setName(name, mimeType, gzipped)
+	if c.opts.Keys != nil {
+		var err error
+		if ret.key, err = newFileKey(ret.ctx, c.opts.Keys, ret.domain); err != nil {
+			return err
+		}
+		ret.Encrypted = true
+	}
+	if ret.compress != nil && (ret.key != nil || ret.IsGzipped || !ret.compress.matches(ret.MimeType)) {
+		ret.compress = nil
+	}
+	if c.opts.JournalDir != "" {
+		var err error
+		if ret.journal, err = createJournal(c.opts.JournalDir, ret); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setName names the file of fid assigned, the mime type and gzip are
+// detected by the name extension if not set.
+func (f *WeedFile) setName(name, mimeType string, gzipped bool) {
+	f.FileName = f.Fid
+	f.RealName = f.Fid
+	if name != "" {
+		baseName := path.Base(name)
+		f.FileName = baseName
+		f.RealName = baseName
+		ext := strings.ToLower(path.Ext(baseName))
+
+		if ext != "" {
+			f.MimeType = mime.TypeByExtension(ext)
+			// The SeaweedFS handle the file with .gz suffix for a special treatment,
+			// so we need to retain all the file suffix.
+			// However, the file with ".css.gz"、".html.gz"、".txt.gz"、".js.gz" etc
+			// will remove the ".gz" suffix, fit for the browser download.
+			// This will cause the MD5 value of the httpClient request inconsistent.
+			if ext == ".gz" {
+				f.IsGzipped = true
+				if needRename(baseName, ext) {
+					f.FileName = f.Fid + ".gz"
+				}
+			}
+		}
+	}
+	if mimeType != "" {
+		f.MimeType = mimeType
+	}
+	if gzipped {
+		f.IsGzipped = true
+	}
+}
+
+// ResumableUploads returns the fids of the upload sessions in the journal
+// directory, which were not closed.
+func (c *Client) ResumableUploads() ([]string, error) {
+	if c.opts.JournalDir == "" {
+		return nil, errors.New("upload journal is disabled")
+	}
+	return listJournals(c.opts.JournalDir)
+}
+
+// Resume resumes the upload session of fid from its journal. The chunks
+// uploaded in order are kept, the returned file has Size bytes uploaded
+// already, the caller continues writing from the offset Size of the source.
+func (c *Client) Resume(ctx context.Context, fid string) (*WeedFile, error) {
+	if c.opts.JournalDir == "" {
+		return nil, errors.New("upload journal is disabled")
+	}
+	path := journalPath(c.opts.JournalDir, fid)
+	sess, err := loadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	if sess.Committed {
+		if len(sess.File.Replaces) == 0 { // otherwise left to the sweeper.
+			os.Remove(path)
+		}
+		return nil, fmt.Errorf("upload of %s is committed already", fid)
+	}
+	if sess.Aborted {
+		return nil, fmt.Errorf("upload of %s is aborted", fid)
+	}
+
+	base, chunks, rest := sess.resumable()
+	for _, chunkFid := range rest { // will be uploaded again.
+		if err := c.uc.DeleteFile(ctx, c.opts.Seeds, chunkFid); err != nil {
+			glog.Warningf("Failed to remove %s of %s, %v", chunkFid, fid, err)
+		}
+	}
+
+	jf := sess.File
+	ret := &WeedFile{
+		Fid:         jf.Fid,
+		FileName:    jf.FileName,
+		RealName:    jf.RealName,
+		IsGzipped:   jf.IsGzipped,
+		MimeType:    jf.MimeType,
+		FileUrl:     jf.FileUrl,
+		TTL:         jf.TTL,
+		readFlag:    false,
+		client:      c,
+		seeds:       c.opts.Seeds,
+		replication: jf.Replication,
+		collection:  jf.Collection,
+		dataCenter:  jf.DataCenter,
+		rack:        jf.Rack,
+		dataNode:    jf.DataNode,
+		chunkSize:   jf.ChunkSize,
+		inflight:    jf.Inflight,
+		buf:         bytes.NewBuffer(nil),
+		split:       len(base)+len(chunks) > 0,
+		chunkInfo:   append(base, chunks...),
+		base:        len(base),
+		replaced:    jf.Replaces,
+		domain:      jf.Domain,
+		ctx:         ctx,
+	}
+	if jf.Key != nil {
+		if ret.key, err = c.fileKey(ctx, jf.Domain, jf.Key); err != nil {
+			return nil, err
+		}
+		ret.Encrypted = true
+	}
+	for _, ci := range ret.chunkInfo {
+		ret.Size += ci.Size
+	}
+	if ret.journal, err = createJournal(c.opts.JournalDir, ret); err != nil {
+		return nil, err
+	}
+	glog.V(4).Infof("Resume seaweed file %s from %d", ret, ret.Size)
+
+	return ret, nil
+}
+
+// Open opens a file for download, see OpenContext.
+func (c *Client) Open(id string, domain int64) (*WeedFile, error) {
+	return c.OpenContext(context.Background(), id, domain)
+}
+
+// OpenContext opens the file by the rest interface and returns it
+// for streaming read, reading fails once ctx is done.
+func (c *Client) OpenContext(ctx context.Context, id string, domain int64) (*WeedFile, error) {
+	return c.OpenWithOptions(ctx, id, &OpenOptions{Domain: domain})
+}
+
+// OpenOptions specifies how to read a file.
+type OpenOptions struct {
+	// Raw reads a gzipped needle as stored, not decompressed, the
+	// offsets and the size are of the gzipped content.
+	Raw bool
+	// Domain of the key to decrypt the file by, if encrypted.
+	Domain int64
+}
+
+// OpenWithOptions is like OpenContext but the file is read by opts.
+func (c *Client) OpenWithOptions(ctx context.Context, id string, opts *OpenOptions) (*WeedFile, error) {
+	if opts == nil {
+		opts = &OpenOptions{}
+	}
+	ret := &WeedFile{
+		Fid:      id,
+		readFlag: true,
+		raw:      opts.Raw,
+		client:   c,
+		seeds:    c.opts.Seeds,
+		ctx:      ctx,
+	}
+
+	locations, err := c.lookupFileId(ctx, ret.Fid)
+	if err != nil {
+		return nil, err
+	}
+	ret.locations = locations
+	ret.size = -1
+
+	// Find out a chunked file by HEAD first if the client reads the chunks
+	// itself, otherwise the volume server starts to stream them for us.
+	if c.opts.ReadAheadChunks > 0 {
+		var fileUrl string
+		var resp *http.Response
+		for _, location := range locations {
+			fileUrl = c.uc.FileUrl(location, ret.Fid)
+			if resp, err = c.uc.Head(ctx, fileUrl); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if resp.Header.Get("X-File-Store") == "chunked" {
+			ret.setHeader(fileUrl, resp)
+			if err := ret.unseal(resp, opts.Domain); err != nil {
+				return nil, err
+			}
+			glog.V(4).Infof("Open seaweed chunked file url: %s...", fileUrl)
+			return ret, nil
+		}
+	}
+
+	resp, err := ret.getRange(ctx, ret.Fid, locations, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	fileUrl := resp.Request.URL.String()
+	ret.setHeader(fileUrl, resp)
+	ret.reader = ret.verify(resp)
+	if err := ret.unseal(resp, opts.Domain); err != nil {
+		ret.Close()
+		return nil, err
+	}
+
+	glog.V(4).Infof("Open seaweed file url: %s...", fileUrl)
+	return ret, nil
+}
+
+// Remove removes the file, see RemoveContext.
+func (c *Client) Remove(id string, domain int64) (bool, error) {
+	return c.RemoveContext(context.Background(), id, domain)
+}
+
+// RemoveContext removes the file, the chunks of a chunked file too,
+// every request is bound to ctx. See RemoveWithOptions.
+func (c *Client) RemoveContext(ctx context.Context, id string, domain int64) (bool, error) {
+	if _, e := c.RemoveWithOptions(ctx, id, nil); e != nil {
+		return false, e
+	}
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// countTransport counts the requests sent through it.
+type countTransport struct {
+	n int64
+}
+
+func (t *countTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestNewClient(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"no seeds":         {},
+		"chunk size":       {Seeds: "localhost:9333", ChunkSize: -1},
+		"large chunk size": {Seeds: "localhost:9333", ChunkSize: MAX_CHUNK_SIZE + 1},
+		"inflight chunks":  {Seeds: "localhost:9333", InflightChunks: -1},
+		"read ahead":       {Seeds: "localhost:9333", ReadAheadChunks: -1},
+		"locality":         {Seeds: "localhost:9333", Locality: true},
+		"hedge delay":      {Seeds: "localhost:9333", HedgeDelay: -1},
+		"hedge percentile": {Seeds: "localhost:9333", HedgePercentile: 1},
+	} {
+		if _, err := NewClient(opts); err == nil {
+			t.Errorf("%s: Expect the options refused", name)
+		}
+	}
+
+	c, err := NewClient(Options{Seeds: "localhost:9333"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if c.opts.InflightChunks != DEFAULT_INFLIGHT_CHUNKS {
+		t.Errorf("Expect %d inflight chunks by default, but %d", DEFAULT_INFLIGHT_CHUNKS, c.opts.InflightChunks)
+	}
+}
+
+func TestClients(t *testing.T) {
+	fa, fb := newFakeCluster(t), newFakeCluster(t)
+	ta, tb := &countTransport{}, &countTransport{}
+	a := fa.client(t, Options{ChunkSize: 100, TTL: "3d", Transport: ta})
+	b := fb.client(t, Options{TTL: "1w", Transport: tb})
+	data := bytes.Repeat([]byte("0123456789"), 30)
+
+	// both on volume 3, a shared lookup cache would read one cluster
+	// for the other.
+	fidA := writeFile(t, a, &CreateOptions{Name: "a.txt"}, data)
+	if ttl := fa.lastAssign().Get("ttl"); ttl != "3d" {
+		t.Errorf("Expect ttl 3d of client a, but %q", ttl)
+	}
+	fidB := writeFile(t, b, &CreateOptions{Name: "b.txt"}, data[:250])
+	if ttl := fb.lastAssign().Get("ttl"); ttl != "1w" {
+		t.Errorf("Expect ttl 1w of client b, but %q", ttl)
+	}
+
+	if n := fa.needle(fidA); n == nil || !n.manifest {
+		t.Errorf("Expect split by the chunk size of client a")
+	}
+	if n := fb.needle(fidB); n == nil || n.manifest {
+		t.Errorf("Expect never split by client b")
+	}
+	if got := readFile(t, a, fidA); !bytes.Equal(got, data) {
+		t.Errorf("Read mismatch of client a, %d bytes", len(got))
+	}
+	if got := readFile(t, b, fidB); !bytes.Equal(got, data[:250]) {
+		t.Errorf("Read mismatch of client b, %d bytes", len(got))
+	}
+	if na, nb := atomic.LoadInt64(&ta.n), atomic.LoadInt64(&tb.n); na == 0 || nb == 0 {
+		t.Errorf("Expect each client by its own transport, but %d, %d requests", na, nb)
+	}
+}
+
+func TestCreateOptions(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 100})
+	data := bytes.Repeat([]byte("0123456789"), 30)
+
+	fid := writeFile(t, c, nil, data) // the options of the client.
+	if n := fc.needle(fid); n == nil || !n.manifest {
+		t.Errorf("Expect split by the chunk size of the client")
+	}
+
+	f, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.txt", Collection: "logs", DataNode: "10.0.0.1:8080", Replication: "001", TTL: "3d"})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	f.Close()
+	form := fc.lastAssign()
+	for k, v := range map[string]string{"collection": "logs", "dataNode": "10.0.0.1:8080", "replication": "001", "ttl": "3d"} {
+		if form.Get(k) != v {
+			t.Errorf("Expect %s %s assigned, but %q", k, v, form.Get(k))
+		}
+	}
+
+	// the chunk size of the file over the one of the client.
+	fid = writeFile(t, c, &CreateOptions{Name: "a.txt", ChunkSize: 1000}, data)
+	if n := fc.needle(fid); n == nil || n.manifest {
+		t.Errorf("Expect never split by the chunk size of the file")
+	}
+	fid = writeFile(t, c, &CreateOptions{Name: "a.txt", ChunkSize: 50}, data)
+	if fi, err := c.Stat(fid, 1); err != nil || fi.Chunks != 6 {
+		t.Errorf("Expect 6 chunks by the chunk size of the file, but %v, %v", fi, err)
+	}
+
+	assigns := fc.assigns
+	for name, opts := range map[string]*CreateOptions{
+		"large chunk size":    {Name: "a.txt", ChunkSize: MAX_CHUNK_SIZE + 1},
+		"short replication":   {Name: "a.txt", Replication: "01"},
+		"invalid replication": {Name: "a.txt", Replication: "0a0"},
+		"invalid ttl":         {Name: "a.txt", TTL: "3x"},
+	} {
+		if _, err := c.CreateWithOptions(context.Background(), opts); err == nil {
+			t.Errorf("%s: Expect the options refused", name)
+		}
+	}
+	if fc.assigns != assigns {
+		t.Errorf("Expect refused before assigned, but %d assigns", fc.assigns-assigns)
+	}
+}
@@ -0,0 +1,290 @@
+package weedfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// fakeVolume is the volume of every needle.
+const fakeVolume = "3"
+
+// fakeModTime is the Last-Modified of every needle.
+var fakeModTime = time.Unix(1500000000, 0)
+
+// fakeNeedle is a file stored in fakeCluster.
+type fakeNeedle struct {
+	name     string
+	mime     string
+	data     []byte
+	gzipped  bool
+	manifest bool
+	header   http.Header // the Seaweed- pairs.
+}
+
+// fakeCluster is a master and a volume server of SeaweedFS in one
+// http server, it keeps the needles in memory.
+type fakeCluster struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	seq      int
+	needles  map[string]*fakeNeedle
+	assigns  int
+	maxCount int              // caps the count of an assign if positive.
+	failures int              // the next batch deletes to fail.
+	failWith int              // the status of the failed batch deletes, 503 if 0.
+	cuts     int              // the next GETs of the content of needles to break halfway.
+	replicas []utils.Location // returned by lookups if set, the cluster itself otherwise.
+	deletes  []string
+	assigned url.Values // the form of the last assign.
+}
+
+func newFakeCluster(t *testing.T) *fakeCluster {
+	fc := &fakeCluster{needles: make(map[string]*fakeNeedle)}
+	fc.Server = httptest.NewServer(http.HandlerFunc(fc.serve))
+	t.Cleanup(fc.Close)
+	return fc
+}
+
+func (fc *fakeCluster) addr() string {
+	return strings.TrimPrefix(fc.URL, "http://")
+}
+
+func (fc *fakeCluster) client(t *testing.T, opts Options) *Client {
+	opts.Seeds = fc.addr()
+	c, err := NewClient(opts)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return c
+}
+
+func (fc *fakeCluster) locations() []utils.Location {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	if fc.replicas != nil {
+		return fc.replicas
+	}
+	return []utils.Location{{Url: fc.addr(), PublicUrl: fc.addr()}}
+}
+
+func (fc *fakeCluster) needle(fid string) *fakeNeedle {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.needles[fid]
+}
+
+func (fc *fakeCluster) put(fid string, n *fakeNeedle) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.needles[fid] = n
+}
+
+// lastAssign returns the form of the last assign.
+func (fc *fakeCluster) lastAssign() url.Values {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.assigned
+}
+
+// lookup returns the locations of volume vid, none but fakeVolume is known.
+func (fc *fakeCluster) lookup(vid string) utils.LookupResult {
+	if vid != fakeVolume {
+		return utils.LookupResult{VolumeId: vid, Error: fmt.Sprintf("volume id %s not found", vid)}
+	}
+	return utils.LookupResult{VolumeId: vid, Locations: fc.locations()}
+}
+
+// setCuts breaks the next n GETs of the content of needles.
+func (fc *fakeCluster) setCuts(n int) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.cuts = n
+}
+
+func (fc *fakeCluster) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/dir/assign":
+		r.ParseForm()
+		count := 1
+		fmt.Sscanf(r.FormValue("count"), "%d", &count)
+		fc.mu.Lock()
+		if fc.maxCount > 0 && count > fc.maxCount {
+			count = fc.maxCount
+		}
+		fc.assigns++
+		fc.assigned = r.Form
+		fc.seq += count
+		fid := fmt.Sprintf("%s,%08x", fakeVolume, fc.seq-count+1)
+		fc.mu.Unlock()
+		l := fc.locations()[0]
+		json.NewEncoder(w).Encode(utils.AssignResult{Fid: fid, Url: l.Url, PublicUrl: l.PublicUrl, Count: uint64(count)})
+	case "/dir/lookup":
+		r.ParseForm()
+		json.NewEncoder(w).Encode(fc.lookup(r.FormValue("volumeId")))
+	case "/vol/lookup":
+		r.ParseForm()
+		ret := make(map[string]utils.LookupResult)
+		for _, vid := range r.Form["volumeId"] {
+			ret[vid] = fc.lookup(vid)
+		}
+		json.NewEncoder(w).Encode(ret)
+	case "/delete":
+		fc.mu.Lock()
+		failed := fc.failures > 0
+		fc.failures--
+		status := fc.failWith
+		fc.mu.Unlock()
+		if failed {
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, "volume server busy", status)
+			return
+		}
+		r.ParseForm()
+		var ret []utils.DeleteResult
+		for _, fid := range r.Form["fid"] {
+			if n := fc.remove(fid); n != nil {
+				ret = append(ret, utils.DeleteResult{Fid: fid, Status: http.StatusAccepted, Size: len(n.data)})
+			} else {
+				ret = append(ret, utils.DeleteResult{Fid: fid, Status: http.StatusNotFound})
+			}
+		}
+		json.NewEncoder(w).Encode(ret)
+	default:
+		fc.serveNeedle(w, r)
+	}
+}
+
+func (fc *fakeCluster) remove(fid string) *fakeNeedle {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	n := fc.needles[fid]
+	delete(fc.needles, fid)
+	fc.deletes = append(fc.deletes, fid)
+	return n
+}
+
+func (fc *fakeCluster) serveNeedle(w http.ResponseWriter, r *http.Request) {
+	fid := strings.TrimPrefix(r.URL.Path, "/")
+	switch r.Method {
+	case "POST", "PUT":
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		n := &fakeNeedle{
+			name:     header.Filename,
+			mime:     header.Header.Get("Content-Type"),
+			data:     data,
+			gzipped:  header.Header.Get("Content-Encoding") == "gzip",
+			manifest: r.FormValue("cm") == "true",
+			header:   make(http.Header),
+		}
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "Seaweed-") {
+				n.header[k] = v
+			}
+		}
+		fc.put(fid, n)
+		json.NewEncoder(w).Encode(utils.UploadResult{Name: n.name, Size: uint32(len(data))})
+	case "DELETE":
+		if fc.remove(fid) == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	case "GET", "HEAD":
+		n := fc.needle(fid)
+		if n == nil {
+			http.NotFound(w, r)
+			return
+		}
+		data := n.data
+		if n.manifest && r.FormValue("cm") != "false" {
+			cm, err := utils.LoadChunkManifest(n.data)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			var buf bytes.Buffer
+			for _, ci := range cm.Chunks {
+				if chunk := fc.needle(ci.Fid); chunk != nil {
+					buf.Write(chunk.data)
+				}
+			}
+			data = buf.Bytes()
+			w.Header().Set("X-File-Store", "chunked")
+		}
+		for k, v := range n.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, n.name))
+		if n.mime != "" {
+			w.Header().Set("Content-Type", n.mime)
+		}
+		if n.gzipped {
+			w.Header().Set("Content-Encoding", "gzip")
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				// decompressed for the client as SeaweedFS does, served as
+				// stored if not gzip indeed.
+				if gz, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+					if b, err := ioutil.ReadAll(gz); err == nil {
+						data = b
+						w.Header().Del("Content-Encoding")
+					}
+				}
+			}
+		}
+		if w.Header().Get("Content-Encoding") != "" && r.Header.Get("Range") == "" {
+			// not set by ServeContent when encoded.
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		w.Header().Set("Etag", fmt.Sprintf(`"%x"`, len(data)))
+		fc.mu.Lock()
+		cut := r.Method == "GET" && r.FormValue("cm") != "false" && fc.cuts > 0
+		if cut {
+			fc.cuts--
+		}
+		fc.mu.Unlock()
+		if cut {
+			w = &cutWriter{ResponseWriter: w}
+		}
+		http.ServeContent(w, r, n.name, fakeModTime, bytes.NewReader(data))
+	}
+}
+
+// cutWriter breaks the connection after half of the body written.
+type cutWriter struct {
+	http.ResponseWriter
+	written int
+}
+
+func (w *cutWriter) Write(p []byte) (int, error) {
+	l, _ := strconv.Atoi(w.Header().Get("Content-Length"))
+	half := l / 2
+	if w.written+len(p) > half {
+		p = p[:half-w.written]
+		w.ResponseWriter.Write(p)
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	w.written += len(p)
+	return w.ResponseWriter.Write(p)
+}
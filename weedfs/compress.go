@@ -0,0 +1,94 @@
+package weedfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"strings"
+)
+
+// CompressionPolicy gzips the content of a file by the client before the
+// upload, the needle is stored with Content-Encoding gzip and decompressed
+// on read. Only a file stored as a single needle is compressed, the chunks
+// of a chunked file are stored as is: the volume server serves a chunked
+// file, whole or by range, by the offsets of the manifest over the chunks
+// as stored, so gzipped chunks would be misread by any reader but this
+// client. The md5 of a needle compressed is of the content stored, the
+// content decompressed on read is checked by utils.PlainMd5Header.
+type CompressionPolicy struct {
+	// MimeTypes to compress, an entry ending with "/" matches the
+	// prefix, e.g. "text/".
+	MimeTypes []string
+	// MinSize is the smallest content worth compressing, a streamed file
+	// of unknown size is always compressed.
+	MinSize int64
+	// Level of gzip, 0 means gzip.DefaultCompression.
+	Level int
+}
+
+// DefaultCompressionPolicy compresses the common text documents.
+var DefaultCompressionPolicy = &CompressionPolicy{
+	MimeTypes: []string{
+		"text/",
+		"application/json",
+		"application/xml",
+		"application/javascript",
+		"image/svg+xml",
+	},
+	MinSize: 1024,
+}
+
+// matches tells the content of the mime type should be compressed.
+func (p *CompressionPolicy) matches(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	for _, t := range p.MimeTypes {
+		if t == mediaType || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// worth tells the content of size is worth compressing, 0 means unknown.
+func (p *CompressionPolicy) worth(size int64) bool {
+	return size == 0 || size >= p.MinSize
+}
+
+func (p *CompressionPolicy) level() int {
+	if p.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return p.Level
+}
+
+// gzipBytes returns data compressed.
+func (p *CompressionPolicy) gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, p.level())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,185 @@
+package weedfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestCompression(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 10000, Compression: DefaultCompressionPolicy})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+
+	for name, tc := range map[string]struct {
+		opts       *CreateOptions
+		data       []byte
+		compressed bool
+		size       bool // the size pair kept.
+	}{
+		"text":       {&CreateOptions{Name: "a.txt"}, data, true, true},
+		"json":       {&CreateOptions{Name: "a", MimeType: "application/json; charset=utf-8"}, data, true, true},
+		"small":      {&CreateOptions{Name: "a.txt"}, data[:100], false, false},
+		"binary":     {&CreateOptions{Name: "a.bin"}, data, false, false},
+		"chunked":    {&CreateOptions{Name: "a.txt", ChunkSize: 1000}, data, false, false},
+		"stream":     {&CreateOptions{Name: "a.txt", ChunkSize: -1}, data, true, false},
+		"sized":      {&CreateOptions{Name: "a.txt", ChunkSize: -1, Size: int64(len(data))}, data, true, true},
+		"disabled":   {&CreateOptions{Name: "a.txt", Compression: &CompressionPolicy{}}, data, false, false},
+		"small sent": {&CreateOptions{Name: "a.txt", ChunkSize: -1, Size: 100}, data[:100], false, false},
+	} {
+		f, err := c.CreateWithOptions(context.Background(), tc.opts)
+		if err != nil {
+			t.Fatalf("%s: Failed to create: %v", name, err)
+		}
+		if _, err := f.Write(tc.data); err != nil {
+			t.Fatalf("%s: Failed to write: %v", name, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("%s: Failed to close: %v", name, err)
+		}
+
+		if f.Compressed != tc.compressed {
+			t.Errorf("%s: Expect compressed %t", name, tc.compressed)
+		}
+		if f.Size != int64(len(tc.data)) {
+			t.Errorf("%s: Expect size %d, but %d", name, len(tc.data), f.Size)
+		}
+		if b := readFile(t, c, f.Fid); !bytes.Equal(b, tc.data) {
+			t.Errorf("%s: Read mismatch, %d bytes", name, len(b))
+		}
+		if !tc.compressed {
+			if f.StoredSize != f.Size {
+				t.Errorf("%s: Expect stored size %d, but %d", name, f.Size, f.StoredSize)
+			}
+			continue
+		}
+
+		n := fc.needle(f.Fid)
+		if !n.gzipped || int64(len(n.data)) != f.StoredSize || f.StoredSize >= f.Size {
+			t.Errorf("%s: Expect %d bytes gzipped stored, but %d", name, f.StoredSize, len(n.data))
+		}
+		if got := n.header.Get(utils.SizeHeader) != ""; got != tc.size {
+			t.Errorf("%s: Expect the size pair %t", name, tc.size)
+		}
+		if md5 := n.header.Get(utils.Md5Header); md5 != "" && md5 != utils.Md5Hex(n.data) {
+			t.Errorf("%s: Expect the md5 of the content stored", name)
+		}
+		if md5 := n.header.Get(utils.PlainMd5Header); md5 != "" && md5 != utils.Md5Hex(tc.data) {
+			t.Errorf("%s: Expect the plain md5 of the content written", name)
+		}
+
+		fi, err := c.Stat(f.Fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to stat: %v", name, err)
+		}
+		logicalSize := int64(-1)
+		if tc.size {
+			logicalSize = int64(len(tc.data))
+		}
+		if !fi.IsGzipped || fi.Size != f.StoredSize || fi.LogicalSize != logicalSize {
+			t.Errorf("%s: Expect %d bytes stored of %d, but %+v", name, f.StoredSize, logicalSize, fi)
+		}
+
+		raw, err := c.OpenWithOptions(context.Background(), f.Fid, &OpenOptions{Raw: true})
+		if err != nil {
+			t.Fatalf("%s: Failed to open raw: %v", name, err)
+		}
+		b, err := ioutil.ReadAll(raw)
+		raw.Close()
+		if err != nil || !bytes.Equal(b, n.data) {
+			t.Errorf("%s: Expect the content as stored, but %d bytes, %v", name, len(b), err)
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: Expect gzip, %v", name, err)
+		}
+		if b, _ := ioutil.ReadAll(gz); !bytes.Equal(b, tc.data) {
+			t.Errorf("%s: Gzip mismatch, %d bytes", name, len(b))
+		}
+	}
+
+	// gzipped already, stored as is.
+	gz, _ := DefaultCompressionPolicy.gzipBytes(data)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.txt.gz"}, gz)
+	if n := fc.needle(fid); !n.gzipped || !bytes.Equal(n.data, gz) || n.header.Get(utils.SizeHeader) != "" {
+		t.Errorf("Expect gzipped content stored as is")
+	}
+}
+
+func TestCompressionRange(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 10000, Compression: DefaultCompressionPolicy})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.txt"}, data)
+
+	f, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	for _, off := range []int64{0, 1000, int64(len(data)) - 10} {
+		p := make([]byte, 10)
+		if n, err := f.ReadAt(p, off); n != len(p) || !bytes.Equal(p, data[off:off+10]) {
+			t.Errorf("Expect %q at %d, but %q, %v", data[off:off+10], off, p[:n], err)
+		}
+	}
+	if l := fc.needle(fid).header.Get(utils.SizeHeader); l != strconv.Itoa(len(data)) {
+		t.Errorf("Expect the size pair %d, but %s", len(data), l)
+	}
+}
+
+func TestCompressionChecksum(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 10000, Compression: DefaultCompressionPolicy})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.txt"}, data)
+	if fc.needle(fid).header.Get(utils.PlainMd5Header) != utils.Md5Hex(data) {
+		t.Fatalf("Expect the plain md5 stored")
+	}
+
+	// corrupted before gzipped, the md5 of the content stored matches.
+	n := fc.needle(fid)
+	n.data, _ = DefaultCompressionPolicy.gzipBytes(bytes.ToUpper(data))
+	n.header.Set(utils.Md5Header, utils.Md5Hex(n.data))
+
+	f, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	if _, err := ioutil.ReadAll(f); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expect checksum mismatch of the content decompressed, but %v", err)
+	}
+}
+
+func TestCompressionPolicy(t *testing.T) {
+	p := &CompressionPolicy{MimeTypes: []string{"text/", "application/json"}, MinSize: 10}
+	for mimeType, expect := range map[string]bool{
+		"text/plain":                      true,
+		"text/html; charset=utf-8":        true,
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/jsonp":               false,
+		"image/png":                       false,
+		"":                                false,
+	} {
+		if got := p.matches(mimeType); got != expect {
+			t.Errorf("Expect %q matched %t", mimeType, expect)
+		}
+	}
+	if !p.worth(0) || p.worth(9) || !p.worth(10) {
+		t.Errorf("Expect worth by the min size")
+	}
+
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{})
+	if _, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.txt", Compression: &CompressionPolicy{Level: 10}}); err == nil {
+		t.Errorf("Expect an invalid level refused")
+	}
+}
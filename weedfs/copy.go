@@ -0,0 +1,104 @@
+package weedfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// CopyOptions specifies the copy of a file, the new file is created by
+// CreateOptions, the name, mime type and gzip of the source are kept
+// if not set.
+type CopyOptions struct {
+	CreateOptions
+	// DeleteSource removes the source after the copy is committed,
+	// the copy acts as a move.
+	DeleteSource bool
+}
+
+// Copy copies the file srcFid on the cluster of seeds, see Client.Copy.
+func Copy(ctx context.Context, seeds, srcFid string, opts *CopyOptions) (string, error) {
+	return defaultClient(seeds, "", "", "").Copy(ctx, srcFid, opts)
+}
+
+// Copy streams the file srcFid, every chunk of a chunked file too, into a
+// newly assigned fid with the replication, collection, data center, rack
+// or TTL of opts, and returns the new fid. In the move mode the source is
+// removed by RemoveWithOptions, if it fails, the new fid is returned with
+// the error and the report of the remove.
+func (c *Client) Copy(ctx context.Context, srcFid string, opts *CopyOptions) (string, error) {
+	if opts == nil {
+		opts = &CopyOptions{}
+	}
+	fi, _, _, err := c.stat(ctx, srcFid)
+	if err != nil {
+		return "", err
+	}
+
+	o := opts.CreateOptions
+	if o.Name == "" && !strings.HasPrefix(fi.Name, srcFid) { // not named by the fid.
+		o.Name = fi.Name
+	}
+	if o.MimeType == "" {
+		o.MimeType = fi.MimeType
+	}
+	var pairs http.Header
+	if fi.IsGzipped {
+		// The chunks are never gzipped, so the copy is a single needle,
+		// with the pairs of the content compressed by the client.
+		o.Gzipped, o.ChunkSize = true, -1
+		pairs = make(http.Header)
+		if fi.LogicalSize >= 0 {
+			pairs.Set(utils.SizeHeader, strconv.FormatInt(fi.LogicalSize, 10))
+		}
+		if fi.PlainMd5 != "" {
+			pairs.Set(utils.PlainMd5Header, fi.PlainMd5)
+		}
+	}
+	size := fi.Size
+	if fi.Encrypted {
+		size = fi.LogicalSize
+	}
+	if o.Size == 0 && size > 0 {
+		o.Size = size
+	}
+
+	// A gzipped needle is read as stored, the copy is gzipped as well.
+	// An encrypted one is decrypted, and encrypted again by a new key
+	// of the domain.
+	src, err := c.OpenWithOptions(ctx, srcFid, &OpenOptions{Raw: fi.IsGzipped, Domain: o.Domain})
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := c.CreateWithOptions(ctx, &o)
+	if err != nil {
+		return "", err
+	}
+	dst.pairs = pairs
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.hasErr = true
+		dst.Close()
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		return "", err
+	}
+	glog.V(4).Infof("Copied %s to %s.", srcFid, dst.Fid)
+
+	if opts.DeleteSource {
+		if report, err := c.RemoveWithOptions(ctx, srcFid, nil); err != nil {
+			return dst.Fid, fmt.Errorf("copied to %s, but failed to remove %s (%v), %w", dst.Fid, srcFid, report, err)
+		}
+	}
+
+	return dst.Fid, nil
+}
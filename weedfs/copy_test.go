@@ -0,0 +1,94 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestCopy(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+
+	for name, tc := range map[string]struct {
+		create *CreateOptions
+		copy   *CopyOptions
+	}{
+		"plain":   {&CreateOptions{Name: "a.txt", ChunkSize: 10000}, &CopyOptions{CreateOptions: CreateOptions{TTL: "3d"}}},
+		"chunked": {&CreateOptions{Name: "a.txt"}, &CopyOptions{CreateOptions: CreateOptions{ChunkSize: 500}}},
+		"gzipped": {&CreateOptions{Name: "a.txt.gz", ChunkSize: -1}, &CopyOptions{CreateOptions: CreateOptions{ChunkSize: 500}}},
+		"move":    {&CreateOptions{Name: "a.txt"}, &CopyOptions{CreateOptions: CreateOptions{ChunkSize: -1}, DeleteSource: true}},
+	} {
+		fid := writeFile(t, c, tc.create, data)
+		var chunkFids []string
+		if n := fc.needle(fid); n.manifest {
+			cm, _ := utils.LoadChunkManifest(n.data)
+			for _, ci := range cm.Chunks {
+				chunkFids = append(chunkFids, ci.Fid)
+			}
+		}
+		newFid, err := c.Copy(context.Background(), fid, tc.copy)
+		if err != nil {
+			t.Fatalf("%s: Failed to copy: %v", name, err)
+		}
+		if newFid == fid {
+			t.Fatalf("%s: Expect a new fid", name)
+		}
+
+		if n := fc.needle(newFid); n.gzipped != (name == "gzipped") {
+			t.Errorf("%s: Expect gzipped kept, but %t", name, n.gzipped)
+		}
+		if name == "gzipped" { // copied as stored.
+			if !bytes.Equal(fc.needle(newFid).data, data) {
+				t.Errorf("%s: Copy mismatch", name)
+			}
+		} else if b := readFile(t, c, newFid); !bytes.Equal(b, data) {
+			t.Errorf("%s: Copy mismatch, %d bytes", name, len(b))
+		}
+		if fi, err := c.Stat(newFid, 1); err != nil || fi.Name != tc.create.Name && name != "gzipped" {
+			t.Errorf("%s: Expect copy named %s, but %v, %v", name, tc.create.Name, fi, err)
+		}
+		if removed := fc.needle(fid) == nil; removed != tc.copy.DeleteSource {
+			t.Errorf("%s: Expect source removed %t", name, tc.copy.DeleteSource)
+		}
+		for _, chunkFid := range chunkFids {
+			if removed := fc.needle(chunkFid) == nil; removed != tc.copy.DeleteSource {
+				t.Errorf("%s: Expect chunk %s removed %t", name, chunkFid, tc.copy.DeleteSource)
+			}
+		}
+	}
+}
+
+func TestCopyCompressed(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 10000, Compression: DefaultCompressionPolicy})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.txt"}, data)
+
+	newFid, err := c.Copy(context.Background(), fid, &CopyOptions{CreateOptions: CreateOptions{ChunkSize: 50}})
+	if err != nil {
+		t.Fatalf("Failed to copy: %v", err)
+	}
+	src, n := fc.needle(fid), fc.needle(newFid)
+	if n.manifest || !n.gzipped || !bytes.Equal(n.data, src.data) {
+		t.Errorf("Expect copied as a gzipped needle")
+	}
+	for _, pair := range []string{utils.SizeHeader, utils.PlainMd5Header} {
+		if n.header.Get(pair) != src.header.Get(pair) {
+			t.Errorf("Expect the pair %s kept, but %q", pair, n.header.Get(pair))
+		}
+	}
+	if b := readFile(t, c, newFid); !bytes.Equal(b, data) {
+		t.Errorf("Copy mismatch, %d bytes", len(b))
+	}
+
+	if newFid, err = c.Copy(context.Background(), fid, nil); err != nil {
+		t.Fatalf("Failed to copy by nil options: %v", err)
+	}
+	if b := readFile(t, c, newFid); !bytes.Equal(b, data) {
+		t.Errorf("Copy mismatch, %d bytes", len(b))
+	}
+}
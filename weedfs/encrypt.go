@@ -0,0 +1,293 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+const (
+	// KeyHeader is the needle pair carrying the data key of an encrypted
+	// file in base64, wrapped by the KeyProvider. It is set on the
+	// manifest of a chunked file too.
+	KeyHeader = "Seaweed-Key"
+	// NonceHeader is the needle pair carrying the nonce of an encrypted
+	// needle in base64.
+	NonceHeader = "Seaweed-Nonce"
+
+	dataKeySize = 32 // AES-256.
+)
+
+var errNoKeys = errors.New("no key provider of the client")
+
+// KeyProvider wraps the data keys of the files by the keys of their
+// domains, e.g. by a KMS. Only the wrapped data key is stored with the
+// file, the plaintext one never leaves the process.
+type KeyProvider interface {
+	// WrapKey encrypts the data key of a file of the domain.
+	WrapKey(ctx context.Context, domain int64, key []byte) ([]byte, error)
+	// UnwrapKey decrypts the data key wrapped by WrapKey.
+	UnwrapKey(ctx context.Context, domain int64, wrapped []byte) ([]byte, error)
+}
+
+// DomainKeys is a KeyProvider by a fixed AES key per domain,
+// of 16, 24 or 32 bytes.
+type DomainKeys map[int64][]byte
+
+func (k DomainKeys) aead(domain int64) (cipher.AEAD, error) {
+	key, ok := k[domain]
+	if !ok {
+		return nil, fmt.Errorf("no key of domain %d", domain)
+	}
+	return newAEAD(key)
+}
+
+// WrapKey seals key by the key of the domain, the nonce prepended.
+func (k DomainKeys) WrapKey(ctx context.Context, domain int64, key []byte) ([]byte, error) {
+	aead, err := k.aead(domain)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
+
+func (k DomainKeys) UnwrapKey(ctx context.Context, domain int64, wrapped []byte) ([]byte, error) {
+	aead, err := k.aead(domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("key of domain %d, %w", domain, ErrDecryption)
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("key of domain %d, %w", domain, ErrDecryption)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fileKey encrypts the content of a file by AES-GCM, each needle or chunk
+// by a nonce of its own. The offset of a chunk in the file is authenticated,
+// so the chunks can not be swapped.
+type fileKey struct {
+	aead    cipher.AEAD
+	wrapped []byte // the data key wrapped, stored with the file.
+}
+
+// newFileKey generates the data key of a new file of the domain.
+func newFileKey(ctx context.Context, keys KeyProvider, domain int64) (*fileKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := keys.WrapKey(ctx, domain, key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKey{aead: aead, wrapped: wrapped}, nil
+}
+
+// fileKey returns the data key of an existing file of the domain.
+func (c *Client) fileKey(ctx context.Context, domain int64, wrapped []byte) (*fileKey, error) {
+	if c.opts.Keys == nil {
+		return nil, errNoKeys
+	}
+	key, err := c.opts.Keys.UnwrapKey(ctx, domain, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &fileKey{aead: aead, wrapped: wrapped}, nil
+}
+
+func offsetData(offset int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(offset))
+	return b
+}
+
+// seal encrypts data at offset of the file by a new nonce.
+func (k *fileKey) seal(data []byte, offset int64) (sealed, nonce []byte, err error) {
+	nonce = make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return k.aead.Seal(nil, nonce, data, offsetData(offset)), nonce, nil
+}
+
+// open decrypts the needle fid sealed at offset of the file.
+func (k *fileKey) open(fid string, sealed, nonce []byte, offset int64) ([]byte, error) {
+	if len(nonce) != k.aead.NonceSize() {
+		return nil, fmt.Errorf("file %s, invalid nonce, %w", fid, ErrDecryption)
+	}
+	data, err := k.aead.Open(nil, nonce, sealed, offsetData(offset))
+	if err != nil {
+		return nil, fmt.Errorf("file %s, %w", fid, ErrDecryption)
+	}
+	return data, nil
+}
+
+// sealHeader sets the pairs of the needle sealed by nonce, size is
+// of the plaintext.
+func (k *fileKey) sealHeader(header http.Header, nonce []byte, size int) {
+	header.Set(KeyHeader, base64.StdEncoding.EncodeToString(k.wrapped))
+	header.Set(NonceHeader, base64.StdEncoding.EncodeToString(nonce))
+	header.Set(utils.SizeHeader, strconv.Itoa(size))
+}
+
+// plainCache keeps the needle decrypted last, for the small reads of it
+// following.
+type plainCache struct {
+	mu   sync.Mutex
+	fid  string
+	data []byte
+}
+
+func (c *plainCache) get(fid string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.data, c.fid == fid
+}
+
+func (c *plainCache) put(fid string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.fid, c.data = fid, data
+}
+
+// unseal sets up the decryption of the file opened by resp if it is
+// encrypted. A needle is read and decrypted at once, a chunked file
+// is decrypted chunk by chunk on read.
+func (f *WeedFile) unseal(resp *http.Response, domain int64) error {
+	value := resp.Header.Get(KeyHeader)
+	if value == "" {
+		return nil
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("file %s, invalid key, %w", f.Fid, ErrDecryption)
+	}
+	if f.key, err = f.client.fileKey(f.ctx, domain, wrapped); err != nil {
+		return err
+	}
+	f.Encrypted = true
+	if f.chunked { // the chunks streamed by the volume server are sealed.
+		if f.reader != nil {
+			f.reader.Close()
+			f.reader = nil
+		}
+		f.size = -1 // by the manifest.
+		return nil
+	}
+
+	if f.nonce, err = base64.StdEncoding.DecodeString(resp.Header.Get(NonceHeader)); err != nil {
+		return fmt.Errorf("file %s, invalid nonce, %w", f.Fid, ErrDecryption)
+	}
+	if f.reader == nil {
+		return nil
+	}
+	sealed, err := ioutil.ReadAll(f.reader)
+	f.reader.Close()
+	f.reader = nil
+	if err != nil {
+		return err
+	}
+	data, err := f.key.open(f.Fid, sealed, f.nonce, 0)
+	if err != nil {
+		return err
+	}
+	f.plain.put(f.Fid, data)
+	f.size = int64(len(data))
+	f.reader = ioutil.NopCloser(bytes.NewReader(data))
+
+	return nil
+}
+
+// readSealed reads the whole needle fid, sealed at offset of the file,
+// and decrypts it.
+func (f *WeedFile) readSealed(ctx context.Context, fid string, locations []utils.Location, nonce []byte, offset int64) ([]byte, error) {
+	if data, ok := f.plain.get(fid); ok {
+		return data, nil
+	}
+
+	var sealed []byte
+	resp, err := f.getRange(ctx, fid, locations, 0, -1)
+	if err == nil {
+		sealed, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data, err := f.key.open(fid, sealed, nonce, offset)
+	if err != nil {
+		return nil, err
+	}
+	f.plain.put(fid, data)
+
+	return data, nil
+}
+
+// nonceOf returns the nonce of the chunk fid of the manifest.
+func nonceOf(cm *utils.ChunkManifest, fid string) []byte {
+	for _, ci := range cm.Chunks {
+		if ci.Fid == fid {
+			return ci.Nonce
+		}
+	}
+	return nil
+}
+
+// readNeedleAt reads len(p) bytes from off of the needle fid, which is
+// at base of the file. A needle encrypted is read whole and decrypted.
+func (f *WeedFile) readNeedleAt(ctx context.Context, fid string, locations []utils.Location, nonce []byte, base int64, p []byte, off int64) (int, error) {
+	if f.key == nil {
+		return f.readRangeAt(ctx, fid, locations, p, off)
+	}
+
+	data, err := f.readSealed(ctx, fid, locations, nonce, base)
+	if err != nil {
+		return 0, err
+	}
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
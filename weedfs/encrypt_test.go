@@ -0,0 +1,181 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+var testKeys = DomainKeys{7: bytes.Repeat([]byte{7}, 32)}
+
+func TestEncryption(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000, Keys: testKeys})
+	ra := fc.client(t, Options{ChunkSize: 1000, Keys: testKeys, ReadAheadChunks: 2})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+
+	for name, tc := range map[string]struct {
+		opts   *CreateOptions
+		reader *Client
+	}{
+		"needle":     {&CreateOptions{Name: "a.txt", Domain: 7, ChunkSize: 10000}, c},
+		"unsplit":    {&CreateOptions{Name: "a.txt", Domain: 7, ChunkSize: -1}, c},
+		"chunked":    {&CreateOptions{Name: "a.txt", Domain: 7}, c},
+		"read ahead": {&CreateOptions{Name: "a.txt", Domain: 7}, ra},
+	} {
+		fid := writeFile(t, c, tc.opts, data)
+		n := fc.needle(fid)
+		if n.header.Get(KeyHeader) == "" {
+			t.Errorf("%s: Expect the wrapped key stored", name)
+		}
+		for _, f := range fc.needles {
+			if bytes.Contains(f.data, data[:36]) {
+				t.Fatalf("%s: Expect no plaintext stored", name)
+			}
+			if f.manifest {
+				cm, _ := utils.LoadChunkManifest(f.data)
+				if cm.Md5 != "" || cm.Chunks[0].Md5 != "" {
+					t.Errorf("%s: Expect no md5 of the plaintext stored", name)
+				}
+			}
+		}
+
+		f, err := tc.reader.Open(fid, 7)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", name, err)
+		}
+		if !f.Encrypted {
+			t.Errorf("%s: Expect encrypted", name)
+		}
+		if b, err := ioutil.ReadAll(f); err != nil || !bytes.Equal(b, data) {
+			t.Errorf("%s: Read mismatch, %d bytes, %v", name, len(b), err)
+		}
+		for _, off := range []int64{0, 990, 2000, int64(len(data)) - 10} {
+			p := make([]byte, 20)
+			n, _ := f.ReadAt(p, off)
+			if !bytes.Equal(p[:n], data[off:off+int64(n)]) || n == 0 {
+				t.Errorf("%s: Expect %q at %d, but %q", name, data[off:off+int64(n)], off, p[:n])
+			}
+		}
+		f.Close()
+
+		fi, err := c.Stat(fid, 7)
+		if err != nil || !fi.Encrypted || fi.LogicalSize != int64(len(data)) {
+			t.Errorf("%s: Expect %d bytes encrypted, but %+v, %v", name, len(data), fi, err)
+		}
+		if _, err := c.Open(fid, 8); err == nil {
+			t.Errorf("%s: Expect no key of domain 8", name)
+		}
+		if _, err := fc.client(t, Options{}).Open(fid, 7); err == nil {
+			t.Errorf("%s: Expect no key provider refused", name)
+		}
+	}
+}
+
+func TestEncryptionTampered(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000, Keys: testKeys})
+	data := bytes.Repeat([]byte("0123456789"), 300)
+
+	for _, chunkSize := range []int64{-1, 1000} {
+		fid := writeFile(t, c, &CreateOptions{Name: "a.txt", Domain: 7, ChunkSize: chunkSize}, data)
+		for _, n := range fc.needles {
+			if !n.manifest {
+				n.data[len(n.data)/2] ^= 0xff
+				n.header.Del(utils.Md5Header) // caught by the md5 otherwise.
+			}
+		}
+
+		_, err := c.Open(fid, 7)
+		if err == nil {
+			f, _ := c.Open(fid, 7)
+			_, err = ioutil.ReadAll(f)
+		}
+		if !errors.Is(err, ErrDecryption) {
+			t.Errorf("Expect the tampered content of chunk size %d refused, but %v", chunkSize, err)
+		}
+	}
+}
+
+func TestEncryptionAppendAndCopy(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000, Keys: testKeys})
+	data := bytes.Repeat([]byte("0123456789"), 250)
+
+	for _, chunkSize := range []int64{-1, 1000} {
+		fid := writeFile(t, c, &CreateOptions{Name: "a.txt", Domain: 7, ChunkSize: chunkSize}, data)
+		f, err := c.OpenAppend(fid, 7)
+		if err != nil {
+			t.Fatalf("Failed to open append: %v", err)
+		}
+		f.Write(data)
+		if err := f.Close(); err != nil {
+			t.Fatalf("Failed to append: %v", err)
+		}
+		r, err := c.Open(fid, 7)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, append(data, data...)) {
+			t.Errorf("Expect appended of chunk size %d, but %d bytes", chunkSize, len(b))
+		}
+		r.Close()
+
+		newFid, err := c.Copy(context.Background(), fid, &CopyOptions{CreateOptions: CreateOptions{Domain: 7}})
+		if err != nil {
+			t.Fatalf("Failed to copy: %v", err)
+		}
+		if fc.needle(newFid).header.Get(KeyHeader) == fc.needle(fid).header.Get(KeyHeader) {
+			t.Errorf("Expect the copy encrypted by a new key")
+		}
+		r, _ = c.Open(newFid, 7)
+		if b, _ := ioutil.ReadAll(r); !bytes.Equal(b, append(data, data...)) {
+			t.Errorf("Copy mismatch, %d bytes", len(b))
+		}
+		r.Close()
+	}
+}
+
+func TestEncryptionBatch(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{Keys: testKeys, Compression: DefaultCompressionPolicy})
+	data := bytes.Repeat([]byte("0123456789"), 200)
+
+	results, err := c.UploadBatch(context.Background(), []*BatchItem{{Name: "a.txt", Data: data}}, &BatchOptions{CreateOptions: CreateOptions{Domain: 7}})
+	if err != nil || results[0].Error != nil {
+		t.Fatalf("Failed to upload batch: %v, %v", err, results[0].Error)
+	}
+	if n := fc.needle(results[0].Fid); n.gzipped || bytes.Contains(n.data, data[:10]) {
+		t.Errorf("Expect encrypted, not compressed")
+	}
+	f, err := c.Open(results[0].Fid, 7)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	if b, _ := ioutil.ReadAll(f); !bytes.Equal(b, data) {
+		t.Errorf("Read mismatch, %d bytes", len(b))
+	}
+}
+
+func TestDomainKeys(t *testing.T) {
+	ctx := context.Background()
+	keys := DomainKeys{1: bytes.Repeat([]byte{1}, 16), 2: bytes.Repeat([]byte{2}, 16)}
+	wrapped, err := keys.WrapKey(ctx, 1, []byte("data key"))
+	if err != nil {
+		t.Fatalf("Failed to wrap: %v", err)
+	}
+	if key, err := keys.UnwrapKey(ctx, 1, wrapped); err != nil || string(key) != "data key" {
+		t.Errorf("Expect the data key, but %q, %v", key, err)
+	}
+	if _, err := keys.UnwrapKey(ctx, 2, wrapped); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Expect the key of another domain refused, but %v", err)
+	}
+	if _, err := keys.WrapKey(ctx, 3, []byte("data key")); err == nil {
+		t.Errorf("Expect no key of domain 3")
+	}
+}
@@ -0,0 +1,33 @@
+package weedfs
+
+import (
+	"errors"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// The kinds of failures returned by the package, tell them apart by
+// errors.Is, the details by errors.As with the error types below.
+var (
+	ErrNotFound          = utils.ErrNotFound
+	ErrNoWritableVolumes = utils.ErrNoWritableVolumes
+	ErrMasterUnavailable = utils.ErrMasterUnavailable
+	ErrVolumeUnavailable = utils.ErrVolumeUnavailable
+	ErrInvalidFid        = utils.ErrInvalidFid
+	ErrChecksumMismatch  = utils.ErrChecksumMismatch
+	ErrPartialDelete     = utils.ErrPartialDelete
+
+	// ErrDecryption is an encrypted file failed to be decrypted, it is
+	// tampered with or of another key.
+	ErrDecryption = errors.New("decryption failed")
+)
+
+// ServerError is a failed request to a master or a volume server.
+type ServerError = utils.ServerError
+
+// ChecksumError is returned by reading a file whose content does not
+// match the md5 recorded on write.
+type ChecksumError = utils.ChecksumError
+
+// PartialDeleteError reports the fids of a file not all deleted.
+type PartialDeleteError = utils.PartialDeleteError
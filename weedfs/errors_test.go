@@ -0,0 +1,30 @@
+package weedfs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 100, Retry: noDeletes})
+
+	if _, err := c.Stat("3,ffffffff", 1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expect not found, but %v", err)
+	}
+	if _, err := c.Stat("malformed", 1); !errors.Is(err, ErrInvalidFid) {
+		t.Errorf("Expect invalid fid, but %v", err)
+	}
+
+	fid := writeFile(t, c, &CreateOptions{Name: "a.bin"}, make([]byte, 250))
+	fc.failures = 10
+	_, err := c.RemoveWithOptions(context.Background(), fid, nil)
+	var pe *PartialDeleteError
+	if !errors.As(err, &pe) || pe.Fid != fid || pe.Total != 3 || len(pe.Failed) != 3 {
+		t.Fatalf("Expect partial delete of 3 chunks, but %v", err)
+	}
+	if !errors.Is(err, ErrPartialDelete) || !errors.Is(pe.Failed[0], ErrVolumeUnavailable) {
+		t.Errorf("Expect partial delete by unavailable volume server, but %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package weedfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// SweepOptions controls a sweep of the orphaned chunks.
+type SweepOptions struct {
+	// MinAge skips the sessions whose journal is modified within MinAge,
+	// they may be still uploading or going to be resumed.
+	// The aborted sessions are always swept.
+	MinAge time.Duration
+	// DryRun reports the chunks to reclaim without deleting them.
+	DryRun bool
+}
+
+// SweepReport reports what a sweep reclaimed.
+type SweepReport struct {
+	Sessions  int      // journals found.
+	Committed int      // committed sessions, nothing to reclaim.
+	Skipped   int      // sessions younger than MinAge.
+	Swept     int      // sessions never committed, their chunks deleted.
+	Reclaimed []string // chunk fids deleted.
+	Bytes     int64    // bytes of the chunks deleted.
+	NotFound  []string // chunk fids assigned but not found.
+	Live      []string // chunk fids referenced by the manifest, kept.
+	Errors    []string
+}
+
+func (r *SweepReport) String() string {
+	return fmt.Sprintf("Sessions:%d, Committed:%d, Skipped:%d, Swept:%d, Reclaimed:%d chunks %d bytes, NotFound:%d, Live:%d, Errors:%d",
+		r.Sessions, r.Committed, r.Skipped, r.Swept, len(r.Reclaimed), r.Bytes, len(r.NotFound), len(r.Live), len(r.Errors))
+}
+
+// Sweep deletes the chunks of the upload sessions in the journal directory
+// whose manifest was never committed, the chunks leaked by a crash or a
+// failed cleanup, and the chunks left of the versions overwritten. A chunk
+// referenced by the manifest on the cluster is never deleted. The journal
+// of a session is removed once its chunks are all deleted.
+func (c *Client) Sweep(ctx context.Context, opts SweepOptions) (*SweepReport, error) {
+	if c.opts.JournalDir == "" {
+		return nil, errors.New("upload journal is disabled")
+	}
+	fids, err := listJournals(c.opts.JournalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SweepReport{}
+	for _, fid := range fids {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Sessions++
+
+		path := journalPath(c.opts.JournalDir, fid)
+		info, err := os.Stat(path)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		sess, err := loadJournal(path)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		if sess.Committed {
+			report.Committed++
+			// chunks of the version overwritten.
+			replaced, err := c.unreferenced(ctx, fid, sess.File.Replaces, report)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", fid, err))
+				continue
+			}
+			if opts.DryRun {
+				report.Reclaimed = append(report.Reclaimed, replaced...)
+				continue
+			}
+			if c.sweepSession(ctx, fid, replaced, report) {
+				os.Remove(path)
+			}
+			continue
+		}
+		if !sess.Aborted && time.Since(info.ModTime()) < opts.MinAge {
+			report.Skipped++
+			continue
+		}
+
+		report.Swept++
+		// The manifest may be committed still, if the process died
+		// before the commit record.
+		chunkFids, err := c.unreferenced(ctx, fid, sess.chunkFids(), report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", fid, err))
+			continue
+		}
+		if opts.DryRun {
+			report.Reclaimed = append(report.Reclaimed, chunkFids...)
+			continue
+		}
+		if c.sweepSession(ctx, fid, chunkFids, report) {
+			os.Remove(path)
+		}
+	}
+
+	return report, nil
+}
+
+// unreferenced returns the chunk fids not referenced by the manifest of
+// session fid on the cluster, the others are reported live and kept.
+// The session is not swept if the manifest fails to be fetched.
+func (c *Client) unreferenced(ctx context.Context, fid string, chunkFids []string, report *SweepReport) ([]string, error) {
+	if len(chunkFids) == 0 {
+		return nil, nil
+	}
+	live, err := c.liveChunks(ctx, fid)
+	if err != nil {
+		return nil, err
+	}
+
+	var rest []string
+	for _, chunkFid := range chunkFids {
+		if live[chunkFid] {
+			report.Live = append(report.Live, chunkFid)
+			continue
+		}
+		rest = append(rest, chunkFid)
+	}
+
+	return rest, nil
+}
+
+// liveChunks returns the chunks referenced by the manifest of fid by
+// cm=false, none if fid is not found or a plain needle.
+func (c *Client) liveChunks(ctx context.Context, fid string) (map[string]bool, error) {
+	locations, err := c.uc.LookupFileId(ctx, c.opts.Seeds, fid)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	for _, location := range locations {
+		manifestUrl := c.uc.FileUrl(location, fid) + "?cm=false"
+		if b, err = c.uc.Get(ctx, manifestUrl); err == nil || errors.Is(err, ErrNotFound) {
+			break
+		}
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cm, err := utils.LoadChunkManifest(b)
+	if err != nil { // a plain needle.
+		return nil, nil
+	}
+
+	live := make(map[string]bool)
+	for _, ci := range cm.Chunks {
+		live[ci.Fid] = true
+	}
+	return live, nil
+}
+
+// sweepSession deletes the chunks of session fid by RemoveMany, a chunk
+// on a volume expired is not found. Returns true if nothing left.
+func (c *Client) sweepSession(ctx context.Context, fid string, chunkFids []string, report *SweepReport) bool {
+	if len(chunkFids) == 0 {
+		return true
+	}
+
+	clean := true
+	for _, r := range c.RemoveMany(ctx, chunkFids, nil) {
+		switch r.Status {
+		case RemoveDeleted:
+			report.Reclaimed = append(report.Reclaimed, r.Fid)
+			report.Bytes += r.Size
+		case RemoveNotFound:
+			report.NotFound = append(report.NotFound, r.Fid)
+		default:
+			clean = false
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", r.Fid, r.Error))
+		}
+	}
+	glog.V(4).Infof("Swept %d chunks of %s, clean %t", len(chunkFids), fid, clean)
+
+	return clean
+}
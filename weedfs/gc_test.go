@@ -0,0 +1,119 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSweep(t *testing.T) {
+	fc := newFakeCluster(t)
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := fc.client(t, Options{ChunkSize: 100, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	crashed, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.log"})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	crashed.Write(data[:350])
+	crashed.waitChunks() // the process dies without Close.
+	writeFile(t, c, &CreateOptions{Name: "b.log"}, data)
+
+	report, err := c.Sweep(context.Background(), SweepOptions{MinAge: time.Hour})
+	if err != nil || report.Skipped != 1 || len(report.Reclaimed) != 0 {
+		t.Fatalf("Expect the young session skipped, but %v, %v", report, err)
+	}
+
+	report, err = c.Sweep(context.Background(), SweepOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sweep: %v", err)
+	}
+	if report.Swept != 1 || len(report.Reclaimed) != 3 || report.Bytes != 300 {
+		t.Fatalf("Expect 3 chunks reclaimed, but %v", report)
+	}
+	for _, ci := range crashed.chunkInfo {
+		if fc.needle(ci.Fid) != nil {
+			t.Errorf("Chunk %s not deleted", ci.Fid)
+		}
+	}
+	if fids, _ := c.ResumableUploads(); len(fids) != 0 {
+		t.Errorf("Expect journal removed, but %v", fids)
+	}
+}
+
+func TestSweepManifestCommitted(t *testing.T) {
+	fc := newFakeCluster(t)
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := fc.client(t, Options{ChunkSize: 100, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	f, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.log"})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	f.Write(data[:350])
+	f.UploadChunk()
+	if err := f.waitChunks(); err != nil {
+		t.Fatalf("Failed to upload chunks: %v", err)
+	}
+	if err := f.UploadManifest(); err != nil { // the process dies before the commit record.
+		t.Fatalf("Failed to upload manifest: %v", err)
+	}
+
+	report, err := c.Sweep(context.Background(), SweepOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sweep: %v", err)
+	}
+	if len(report.Reclaimed) != 0 || len(report.Live) != 4 {
+		t.Fatalf("Expect 4 chunks live kept, but %v", report)
+	}
+	if b := readFile(t, c, f.Fid); !bytes.Equal(b, data[:350]) {
+		t.Errorf("Expect the file intact, but %d bytes", len(b))
+	}
+	if fids, _ := c.ResumableUploads(); len(fids) != 0 {
+		t.Errorf("Expect journal removed, but %v", fids)
+	}
+}
+
+func TestSweepVolumeExpired(t *testing.T) {
+	fc := newFakeCluster(t)
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := fc.client(t, Options{ChunkSize: 100, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	crashed, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.log"})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	crashed.Write(data[:250])
+	crashed.waitChunks()
+	// a chunk on a volume expired by its TTL, unknown to the master.
+	crashed.journal.append(&journalRecord{Type: recordAssign, Fid: "9,0123abcd"})
+
+	report, err := c.Sweep(context.Background(), SweepOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sweep: %v", err)
+	}
+	if len(report.Reclaimed) != 2 || len(report.NotFound) != 1 || len(report.Errors) != 0 {
+		t.Fatalf("Expect 2 chunks reclaimed and 1 not found, but %v", report)
+	}
+	if fids, _ := c.ResumableUploads(); len(fids) != 0 {
+		t.Errorf("Expect journal removed, but %v", fids)
+	}
+}
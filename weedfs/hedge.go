@@ -0,0 +1,171 @@
+package weedfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+const (
+	latencyWindow     = 128 // latencies kept per replica.
+	latencyMinSamples = 16  // samples needed before a percentile is trusted.
+)
+
+// latencyStats keeps the recent latencies of the response headers of
+// every replica, by the url of the location.
+type latencyStats struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration // ring buffers.
+	next    map[string]int
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{
+		samples: make(map[string][]time.Duration),
+		next:    make(map[string]int),
+	}
+}
+
+func (s *latencyStats) record(server string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples[server]) < latencyWindow {
+		s.samples[server] = append(s.samples[server], d)
+		return
+	}
+	s.samples[server][s.next[server]] = d
+	s.next[server] = (s.next[server] + 1) % latencyWindow
+}
+
+// percentile returns the latency of the server at p in (0, 1), false if
+// there are not enough samples yet.
+func (s *latencyStats) percentile(server string, p float64) (time.Duration, bool) {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.samples[server]...)
+	s.mu.Unlock()
+	if len(sorted) < latencyMinSamples {
+		return 0, false
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))], true
+}
+
+// hedgeDelay returns how long to wait for the location before sending
+// the request to the next one as well.
+func (c *Client) hedgeDelay(location utils.Location) time.Duration {
+	if c.opts.HedgePercentile > 0 {
+		if d, ok := c.latency.percentile(location.Url, c.opts.HedgePercentile); ok {
+			return d
+		}
+	}
+	return c.opts.HedgeDelay
+}
+
+// rangeResult is the response of a hedged request to the location i.
+type rangeResult struct {
+	i      int
+	resp   *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// hedgedRange requests the range of the needle fid from the first location,
+// and from the next location as well whenever the last one has not
+// responded within its hedge delay, or has failed. The first response wins,
+// the others are cancelled. It returns the response and its location.
+func (f *WeedFile) hedgedRange(ctx context.Context, fid string, locations []utils.Location, offset, length int64) (*http.Response, int, error) {
+	c := f.client
+	results := make(chan *rangeResult, len(locations))
+	cancels := make([]context.CancelFunc, len(locations))
+	start := func(i int) {
+		hctx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		fileUrl := c.uc.FileUrl(locations[i], fid)
+		go func() {
+			begin := time.Now()
+			resp, err := f.rangeOf(hctx, fileUrl, offset, length)
+			if err == nil {
+				c.latency.record(locations[i].Url, time.Since(begin))
+			}
+			results <- &rangeResult{i: i, resp: resp, err: err, cancel: cancel}
+		}()
+	}
+
+	start(0)
+	next, pending := 1, 1
+	timer := time.NewTimer(c.hedgeDelay(locations[0]))
+	defer timer.Stop()
+	var err error
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if next < len(locations) {
+				glog.V(4).Infof("Hedge the read of %s to %s", fid, c.uc.Address(locations[next]))
+				start(next)
+				timer.Reset(c.hedgeDelay(locations[next]))
+				next, pending = next+1, pending+1
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil || r.err == io.EOF {
+				for i, cancel := range cancels {
+					if i != r.i && cancel != nil {
+						cancel()
+					}
+				}
+				go drainRanges(results, pending)
+				if r.resp != nil {
+					r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: r.cancel}
+				} else {
+					r.cancel()
+				}
+				return r.resp, r.i, r.err
+			}
+			r.cancel()
+			err = r.err
+			glog.V(4).Infof("Failed to read %s from %s at %d, %v", fid, c.uc.Address(locations[r.i]), offset, err)
+			if next < len(locations) { // no need to wait.
+				start(next)
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(c.hedgeDelay(locations[next]))
+				next, pending = next+1, pending+1
+			}
+		}
+	}
+
+	return nil, 0, err
+}
+
+// drainRanges closes the responses of the requests lost.
+func drainRanges(results <-chan *rangeResult, pending int) {
+	for ; pending > 0; pending-- {
+		if r := <-results; r.resp != nil {
+			r.resp.Body.Close()
+		}
+	}
+}
+
+// cancelBody releases the context of the request once the body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,66 @@
+package weedfs
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestHedgedRead(t *testing.T) {
+	fc := newFakeCluster(t)
+	var cancelled int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			atomic.AddInt32(&cancelled, 1)
+			return
+		case <-time.After(2 * time.Second):
+		}
+		fc.serveNeedle(w, r)
+	}))
+	defer slow.Close()
+
+	data := []byte("hedged read")
+	fid := writeFile(t, fc.client(t, Options{}), &CreateOptions{Name: "a.txt"}, data)
+
+	slowAddr := strings.TrimPrefix(slow.URL, "http://")
+	fc.replicas = []utils.Location{{Url: slowAddr, PublicUrl: slowAddr}, {Url: fc.addr(), PublicUrl: fc.addr()}}
+	c := fc.client(t, Options{HedgeDelay: 20 * time.Millisecond})
+
+	start := time.Now()
+	if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+		t.Errorf("Expect %q, but %q", data, b)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expect the slow replica hedged, but elapsed %v", elapsed)
+	}
+	for i := 0; i < 100 && atomic.LoadInt32(&cancelled) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&cancelled) != 1 {
+		t.Error("Expect the request to the slow replica cancelled")
+	}
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	s := newLatencyStats()
+	if _, ok := s.percentile("a", 0.9); ok {
+		t.Error("Expect no percentile without samples")
+	}
+	for i := 1; i <= latencyWindow+100; i++ {
+		s.record("a", time.Duration(i)*time.Millisecond)
+	}
+	// the window keeps the latest, 101ms to 228ms.
+	if d, ok := s.percentile("a", 0.5); !ok || d != 164*time.Millisecond {
+		t.Errorf("Expect median 164ms, but %v", d)
+	}
+	if d, _ := s.percentile("a", 0); d != 101*time.Millisecond {
+		t.Errorf("Expect min 101ms, but %v", d)
+	}
+}
@@ -0,0 +1,285 @@
+package weedfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+const (
+	journalExt = ".journal"
+
+	recordBegin  = "begin"
+	recordAssign = "assign" // a chunk fid assigned, before uploading.
+	recordChunk  = "chunk"
+	recordCommit = "commit"
+	recordAbort  = "abort" // cleanup failed, the chunks left to the sweeper.
+)
+
+// journalFile is the state of a WeedFile needed to resume the upload.
+type journalFile struct {
+	Fid         string `json:"fid"`
+	FileName    string `json:"fileName,omitempty"`
+	RealName    string `json:"realName,omitempty"`
+	MimeType    string `json:"mime,omitempty"`
+	IsGzipped   bool   `json:"gzipped,omitempty"`
+	FileUrl     string `json:"url"`
+	TTL         string `json:"ttl,omitempty"`
+	Replication string `json:"replication,omitempty"`
+	Collection  string `json:"collection,omitempty"`
+	DataCenter  string `json:"dataCenter,omitempty"`
+	Rack        string `json:"rack,omitempty"`
+	DataNode    string `json:"dataNode,omitempty"`
+	ChunkSize   int64  `json:"chunkSize"`
+	Inflight    int    `json:"inflight,omitempty"`
+	// Replaces are the chunks of the version overwritten,
+	// deleted after the session is committed.
+	Replaces []string `json:"replaces,omitempty"`
+	// Base are the chunks of the version appended to, never deleted.
+	Base utils.ChunkList `json:"base,omitempty"`
+	// Key is the data key of a file encrypted, wrapped by the key of Domain.
+	Key    []byte `json:"key,omitempty"`
+	Domain int64  `json:"domain,omitempty"`
+}
+
+// journalRecord is a line of the journal.
+type journalRecord struct {
+	Type   string           `json:"type"`
+	Fid    string           `json:"fid,omitempty"`
+	File   *journalFile     `json:"file,omitempty"`
+	Chunk  *utils.ChunkInfo `json:"chunk,omitempty"`
+	Source int64            `json:"source,omitempty"` // source offset after the chunk.
+}
+
+// journal records an upload session in a local file, one record per line,
+// so that the session can be resumed after the process dies, or the
+// chunks of a session never committed can be swept.
+type journal struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func journalPath(dir, fid string) string {
+	return filepath.Join(dir, strings.Replace(fid, ",", "_", -1)+journalExt)
+}
+
+// createJournal creates the journal of the file and records its state
+// and the chunks uploaded already. The journal is written aside and
+// renamed, so an existing journal of the file is replaced atomically.
+func createJournal(dir string, f *WeedFile) (*journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	j := &journal{path: journalPath(dir, f.Fid)}
+	file, err := os.OpenFile(j.path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+
+	err = j.append(&journalRecord{Type: recordBegin, File: f.journalFile()})
+	for _, ci := range f.chunkInfo[f.base:] {
+		if err != nil {
+			break
+		}
+		err = j.append(&journalRecord{Type: recordChunk, Chunk: ci, Source: ci.Offset + ci.Size})
+	}
+	if err == nil {
+		err = os.Rename(j.path+".tmp", j.path)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(j.path + ".tmp")
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// append writes the record and syncs it to disk.
+func (j *journal) append(rec *journalRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// close closes the journal but leaves it for the sweeper.
+func (j *journal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// remove closes and removes the journal, the session is over.
+func (j *journal) remove() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.file.Close()
+	return os.Remove(j.path)
+}
+
+// journalSession is an upload session loaded from a journal.
+type journalSession struct {
+	File      *journalFile
+	Assigned  []string        // chunk fids assigned.
+	Chunks    utils.ChunkList // uploaded chunks.
+	Committed bool            // the manifest is uploaded.
+	Aborted   bool            // the chunks may be deleted partly.
+}
+
+// chunkFids returns all the chunk fids of the session, assigned or uploaded.
+func (sess *journalSession) chunkFids() []string {
+	var fids []string
+	seen := make(map[string]bool)
+	for _, fid := range sess.Assigned {
+		if !seen[fid] {
+			seen[fid] = true
+			fids = append(fids, fid)
+		}
+	}
+	for _, ci := range sess.Chunks {
+		if !seen[ci.Fid] {
+			seen[ci.Fid] = true
+			fids = append(fids, ci.Fid)
+		}
+	}
+
+	return fids
+}
+
+// loadJournal reads the journal of path, a truncated last line
+// left by a crash is ignored.
+func loadJournal(path string) (*journalSession, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sess := &journalSession{}
+	r := bufio.NewReader(file)
+	for {
+		line, err := utils.Readln(r)
+		if err != nil {
+			break
+		}
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			break
+		}
+		switch rec.Type {
+		case recordBegin:
+			sess.File = rec.File
+		case recordAssign:
+			sess.Assigned = append(sess.Assigned, rec.Fid)
+		case recordChunk:
+			sess.Chunks = append(sess.Chunks, rec.Chunk)
+		case recordCommit:
+			sess.Committed = true
+		case recordAbort:
+			sess.Aborted = true
+		}
+	}
+	if sess.File == nil {
+		return nil, fmt.Errorf("invalid journal %s", path)
+	}
+
+	return sess, nil
+}
+
+// resumable splits the chunks into the contiguous uploaded ones following
+// the base chunks, which the session resumes from, and the fids of the
+// rest, uploaded out of order or maybe uploaded.
+func (sess *journalSession) resumable() (base, chunks []*utils.ChunkInfo, rest []string) {
+	byOffset := make(map[int64]*utils.ChunkInfo)
+	for _, ci := range sess.Chunks {
+		byOffset[ci.Offset] = ci
+	}
+
+	kept := make(map[string]bool)
+	var offset int64
+	for _, ci := range sess.File.Base {
+		base = append(base, ci)
+		offset = ci.Offset + ci.Size
+	}
+	for {
+		ci, ok := byOffset[offset]
+		if !ok {
+			break
+		}
+		chunks = append(chunks, ci)
+		kept[ci.Fid] = true
+		offset += ci.Size
+	}
+	for _, fid := range sess.chunkFids() {
+		if !kept[fid] {
+			rest = append(rest, fid)
+		}
+	}
+
+	return base, chunks, rest
+}
+
+// listJournals returns the fids of the sessions recorded in dir.
+func listJournals(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var fids []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasSuffix(name, journalExt) {
+			continue
+		}
+		fids = append(fids, strings.Replace(strings.TrimSuffix(name, journalExt), "_", ",", 1))
+	}
+
+	return fids, nil
+}
+
+func (f *WeedFile) journalFile() *journalFile {
+	jf := &journalFile{
+		Fid:         f.Fid,
+		FileName:    f.FileName,
+		RealName:    f.RealName,
+		MimeType:    f.MimeType,
+		IsGzipped:   f.IsGzipped,
+		FileUrl:     f.FileUrl,
+		TTL:         f.TTL,
+		Replication: f.replication,
+		Collection:  f.collection,
+		DataCenter:  f.dataCenter,
+		Rack:        f.rack,
+		DataNode:    f.dataNode,
+		ChunkSize:   f.chunkSize,
+		Inflight:    f.inflight,
+		Replaces:    f.replaced,
+		Base:        f.chunkInfo[:f.base],
+		Domain:      f.domain,
+	}
+	if f.key != nil {
+		jf.Key = f.key.wrapped
+	}
+	return jf
+}
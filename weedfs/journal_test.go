@@ -0,0 +1,57 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	fc := newFakeCluster(t)
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := fc.client(t, Options{ChunkSize: 100, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789"), 100)
+
+	f, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.log"})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	f.Write(data[:350])
+	f.waitChunks() // the process dies without Close.
+
+	fids, err := c.ResumableUploads()
+	if err != nil || len(fids) != 1 || fids[0] != f.Fid {
+		t.Fatalf("Expect resumable upload %s, but %v, %v", f.Fid, fids, err)
+	}
+
+	r, err := c.Resume(context.Background(), f.Fid)
+	if err != nil {
+		t.Fatalf("Failed to resume: %v", err)
+	}
+	if r.Size != 300 || len(r.chunkInfo) != 3 {
+		t.Fatalf("Expect 3 chunks resumed, but size %d, %d chunks", r.Size, len(r.chunkInfo))
+	}
+	r.Write(data[r.Size:])
+	if err := r.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	o, err := c.Open(f.Fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer o.Close()
+	b, _ := ioutil.ReadAll(o)
+	if !bytes.Equal(b, data) {
+		t.Fatalf("Resumed file mismatch, %d bytes", len(b))
+	}
+	if fids, _ := c.ResumableUploads(); len(fids) != 0 {
+		t.Errorf("Expect journal removed, but %v", fids)
+	}
+}
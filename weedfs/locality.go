@@ -0,0 +1,59 @@
+package weedfs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// topologyRetry is the delay to fetch the topology again after failed.
+const topologyRetry = time.Minute
+
+// topologyCache keeps the topology of the cluster fetched from the master.
+type topologyCache struct {
+	mu      sync.Mutex
+	topo    utils.Topology
+	expires time.Time
+}
+
+// topology returns the configured topology, or the one of the master
+// refreshed every utils.EXPIRED_TIME, nil if never fetched.
+func (c *Client) topology(ctx context.Context) utils.Topology {
+	if c.opts.Topology != nil {
+		return c.opts.Topology
+	}
+
+	c.topo.mu.Lock()
+	defer c.topo.mu.Unlock()
+	if time.Now().After(c.topo.expires) {
+		topo, err := c.uc.FetchTopology(ctx, c.opts.Seeds)
+		if err != nil {
+			glog.Warningf("Failed to fetch topology from %s, %v", c.opts.Seeds, err)
+			c.topo.expires = time.Now().Add(topologyRetry)
+		} else {
+			c.topo.topo = topo
+			c.topo.expires = time.Now().Add(utils.EXPIRED_TIME)
+		}
+	}
+
+	return c.topo.topo
+}
+
+// lookupFileId returns the locations to read fid, the nearest first if
+// the client reads by locality.
+func (c *Client) lookupFileId(ctx context.Context, fid string) ([]utils.Location, error) {
+	locations, err := c.uc.LookupFileId(ctx, c.opts.Seeds, fid)
+	if err != nil || !c.opts.Locality || len(locations) < 2 {
+		return locations, err
+	}
+	topo := c.topology(ctx)
+	if topo == nil {
+		return locations, nil
+	}
+
+	return topo.Rank(locations, utils.Placement{DataCenter: c.opts.DataCenter, Rack: c.opts.Rack}), nil
+}
@@ -0,0 +1,39 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestLocality(t *testing.T) {
+	fc := newFakeCluster(t)
+	data := []byte("read nearby")
+	fid := writeFile(t, fc.client(t, Options{}), &CreateOptions{Name: "a.txt"}, data)
+
+	// the far replica is listed first, and unreachable.
+	fc.replicas = []utils.Location{{Url: "127.0.0.1:1", PublicUrl: "127.0.0.1:1"}, {Url: fc.addr(), PublicUrl: fc.addr()}}
+	topo := utils.Topology{"127.0.0.1:1": {DataCenter: "dc2"}, fc.addr(): {DataCenter: "dc1", Rack: "r1"}}
+	if _, err := NewClient(Options{Seeds: fc.addr(), Locality: true}); err == nil {
+		t.Error("Expect locality without data center refused")
+	}
+	c := fc.client(t, Options{Locality: true, DataCenter: "dc1", Topology: topo})
+
+	locations, err := c.lookupFileId(context.Background(), fid)
+	if err != nil || len(locations) != 2 || locations[0].Url != fc.addr() {
+		t.Fatalf("Expect the near replica first, but %v, %v", locations, err)
+	}
+	f, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	if f.FileUrl != "http://"+fc.addr()+"/"+fid {
+		t.Errorf("Expect read from the near replica, but %s", f.FileUrl)
+	}
+	if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+		t.Errorf("Expect %q, but %q", data, b)
+	}
+}
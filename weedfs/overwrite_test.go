@@ -0,0 +1,62 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "overwrite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000, JournalDir: dir})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.txt"}, data)
+	cm, err := utils.LoadChunkManifest(fc.needle(fid).data)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	content := []byte("the new version")
+	f, err := c.OverwriteWithOptions(context.Background(), fid, &CreateOptions{ChunkSize: 10000})
+	if err != nil {
+		t.Fatalf("Failed to overwrite: %v", err)
+	}
+	if f.Fid != fid || f.RealName != "a.txt" {
+		t.Errorf("Expect %s named a.txt, but %s", fid, f)
+	}
+	f.Write(content)
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+
+	r, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer r.Close()
+	if b, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(b, content) {
+		t.Errorf("Expect %q, but %q, %v", content, b, err)
+	}
+	for _, ci := range cm.Chunks {
+		if fc.needle(ci.Fid) != nil {
+			t.Errorf("Expect chunk %s of the old version deleted", ci.Fid)
+		}
+	}
+	if fids, _ := c.ResumableUploads(); len(fids) != 0 {
+		t.Errorf("Expect no journal left, but %v", fids)
+	}
+
+	if _, err := c.Overwrite("3,ffffffff", 1); err == nil {
+		t.Error("Expect overwriting a missing file failed")
+	}
+}
@@ -0,0 +1,103 @@
+package weedfs
+
+import (
+	"context"
+	"sync"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// chunkPipeline uploads the chunks of a file concurrently,
+// at most cap(slots) chunks are in flight at the same time.
+type chunkPipeline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	chunks []*utils.ChunkInfo // indexed by the chunk sequence, nil until uploaded.
+	err    error              // the first failure.
+}
+
+func newChunkPipeline(ctx context.Context, inflight int) *chunkPipeline {
+	if inflight <= 0 {
+		inflight = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &chunkPipeline{
+		ctx:    ctx,
+		cancel: cancel,
+		slots:  make(chan struct{}, inflight),
+	}
+}
+
+// submit schedules the upload of chunk ci, it blocks while the pipeline is full.
+// The upload function owns data, and returns the fid and size of the chunk.
+func (p *chunkPipeline) submit(ci *utils.ChunkInfo, data []byte, upload func(ctx context.Context, data []byte) (string, int64, error)) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-p.ctx.Done():
+		return p.failure()
+	}
+	if err := p.failure(); err != nil {
+		<-p.slots
+		return err
+	}
+
+	p.mu.Lock()
+	idx := len(p.chunks)
+	p.chunks = append(p.chunks, nil)
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+
+		fid, size, err := upload(p.ctx, data)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if fid != "" && err == nil {
+			ci.Fid = fid
+			ci.Size = size
+			p.chunks[idx] = ci
+		}
+		if err != nil && p.err == nil {
+			p.err = err
+			p.cancel() // no need to upload the rest.
+		}
+	}()
+
+	return nil
+}
+
+// failure returns the first failure, or the reason of the cancellation.
+func (p *chunkPipeline) failure() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	return p.ctx.Err()
+}
+
+// wait waits for all the submitted chunks, and returns the uploaded
+// chunks in offset order together with the first failure.
+func (p *chunkPipeline) wait() ([]*utils.ChunkInfo, error) {
+	p.wg.Wait()
+	err := p.failure()
+	p.cancel()
+
+	chunks := make([]*utils.ChunkInfo, 0, len(p.chunks))
+	for _, ci := range p.chunks {
+		if ci != nil {
+			chunks = append(chunks, ci)
+		}
+	}
+
+	return chunks, err
+}
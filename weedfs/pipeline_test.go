@@ -0,0 +1,61 @@
+package weedfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func TestChunkPipelineOrder(t *testing.T) {
+	p := newChunkPipeline(context.Background(), 3)
+	for i := 0; i < 10; i++ {
+		i := i
+		err := p.submit(&utils.ChunkInfo{Offset: int64(i * 10)}, make([]byte, 10), func(ctx context.Context, data []byte) (string, int64, error) {
+			time.Sleep(time.Duration(rand.Intn(10)) * time.Millisecond)
+			return fmt.Sprintf("1,%02d", i), int64(len(data)), nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to submit: %v", err)
+		}
+	}
+
+	chunks, err := p.wait()
+	if err != nil {
+		t.Fatalf("Failed to wait: %v", err)
+	}
+	if len(chunks) != 10 {
+		t.Fatalf("Expect 10 chunks, but %d", len(chunks))
+	}
+	for i, ci := range chunks {
+		if ci.Offset != int64(i*10) || ci.Fid != fmt.Sprintf("1,%02d", i) {
+			t.Errorf("Chunk %d out of order: %+v", i, ci)
+		}
+	}
+}
+
+func TestChunkPipelineFailure(t *testing.T) {
+	failure := errors.New("upload failed")
+	p := newChunkPipeline(context.Background(), 2)
+	p.submit(&utils.ChunkInfo{}, nil, func(ctx context.Context, data []byte) (string, int64, error) {
+		return "1,01", 0, nil
+	})
+	p.submit(&utils.ChunkInfo{}, nil, func(ctx context.Context, data []byte) (string, int64, error) {
+		return "1,02", 0, failure
+	})
+
+	chunks, err := p.wait()
+	if err != failure {
+		t.Fatalf("Expect %v, but %v", failure, err)
+	}
+	if len(chunks) != 1 || chunks[0].Fid != "1,01" {
+		t.Fatalf("Expect the uploaded chunk only, but %v", chunks)
+	}
+	if err := p.submit(&utils.ChunkInfo{}, nil, nil); err != failure {
+		t.Fatalf("Expect submit refused by %v, but %v", failure, err)
+	}
+}
@@ -0,0 +1,120 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// chunkFetch is a chunk downloading in background.
+type chunkFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// readAheadReader streams a chunked file from offset, it fetches the chunks
+// from their own volume servers in parallel but returns them in order.
+// At most window chunks are buffered or downloading at the same time,
+// the chunk being read included.
+type readAheadReader struct {
+	f      *WeedFile
+	ctx    context.Context
+	cancel context.CancelFunc
+	window int
+
+	cm      *utils.ChunkManifest
+	views   []utils.ChunkView // chunks not scheduled yet.
+	pending []*chunkFetch     // scheduled chunks in offset order.
+	cur     *bytes.Reader     // the chunk being read.
+}
+
+func newReadAheadReader(f *WeedFile, cm *utils.ChunkManifest, offset int64, window int) *readAheadReader {
+	ctx, cancel := context.WithCancel(f.ctx)
+	return &readAheadReader{
+		f:      f,
+		ctx:    ctx,
+		cancel: cancel,
+		window: window,
+		cm:     cm,
+		views:  cm.ViewsAt(offset, cm.Size-offset),
+	}
+}
+
+func (r *readAheadReader) Read(p []byte) (int, error) {
+	for r.cur == nil || r.cur.Len() == 0 {
+		r.cur = nil // released, its slot is free.
+		r.schedule()
+		if len(r.pending) == 0 {
+			return 0, io.EOF
+		}
+
+		fetch := r.pending[0]
+		select {
+		case <-fetch.done:
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		}
+		if fetch.err != nil {
+			return 0, fetch.err
+		}
+		r.pending = r.pending[1:]
+		r.cur = bytes.NewReader(fetch.data)
+		r.schedule() // refill the window, less the chunk being read.
+	}
+
+	return r.cur.Read(p)
+}
+
+// schedule starts fetching the following chunks until the window is full.
+func (r *readAheadReader) schedule() {
+	window := r.window
+	if r.cur != nil {
+		window--
+	}
+	for len(r.pending) < window && len(r.views) > 0 {
+		view := r.views[0]
+		r.views = r.views[1:]
+
+		fetch := &chunkFetch{done: make(chan struct{})}
+		r.pending = append(r.pending, fetch)
+		go func() {
+			defer close(fetch.done)
+			fetch.data, fetch.err = r.fetch(view)
+		}()
+	}
+}
+
+func (r *readAheadReader) fetch(view utils.ChunkView) ([]byte, error) {
+	locations, err := r.f.client.lookupFileId(r.ctx, view.Fid)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, view.Size)
+	base := view.LogicOffset - view.Offset
+	n, err := r.f.readNeedleAt(r.ctx, view.Fid, locations, nonceOf(r.cm, view.Fid), base, data, view.Offset)
+	if err == io.EOF && int64(n) < view.Size {
+		err = io.ErrUnexpectedEOF // chunk shorter than the manifest said.
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if view.Md5 != "" {
+		if err := utils.VerifyMd5(view.Fid, data, view.Md5); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// Close stops the downloading chunks.
+func (r *readAheadReader) Close() error {
+	r.cancel()
+	r.pending = nil
+	r.views = nil
+	return nil
+}
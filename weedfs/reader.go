@@ -0,0 +1,484 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+var (
+	errWhence   = errors.New("Seek: invalid whence")
+	errOffset   = errors.New("Seek: invalid offset")
+	errNotRead  = errors.New("file not opened for read")
+	errNegative = errors.New("ReadAt: negative offset")
+)
+
+// ReadAt reads len(p) bytes from the offset off of the file, it does not
+// affect the offset of Read. For a plain needle it is a Range request,
+// for a chunked file the range is mapped onto the chunks of the manifest.
+func (f *WeedFile) ReadAt(p []byte, off int64) (int, error) {
+	if !f.readFlag {
+		return 0, errNotRead
+	}
+	if off < 0 {
+		return 0, errNegative
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	cm, err := f.chunkManifest()
+	if err != nil {
+		return 0, err
+	}
+	if cm == nil {
+		return f.readNeedleAt(f.ctx, f.Fid, f.locations, f.nonce, 0, p, off)
+	}
+
+	var n int
+	for _, view := range cm.ViewsAt(off, int64(len(p))) {
+		locations, err := f.client.lookupFileId(f.ctx, view.Fid)
+		if err != nil {
+			return n, err
+		}
+		start := view.LogicOffset - off
+		base := view.LogicOffset - view.Offset
+		m, err := f.readNeedleAt(f.ctx, view.Fid, locations, nonceOf(cm, view.Fid), base, p[start:start+view.Size], view.Offset)
+		n += m
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF // chunk shorter than the manifest said.
+			}
+			return n, err
+		}
+		if view.Md5 != "" {
+			if err := utils.VerifyMd5(view.Fid, p[start:start+view.Size], view.Md5); err != nil {
+				return n, err
+			}
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// Seek sets the offset for the next Read, the next Read after a Seek
+// opens a new stream from the offset.
+func (f *WeedFile) Seek(offset int64, whence int) (int64, error) {
+	if !f.readFlag {
+		return 0, errNotRead
+	}
+
+	switch whence {
+	default:
+		return 0, errWhence
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		size, err := f.fileSize()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	}
+	if offset < 0 {
+		return 0, errOffset
+	}
+
+	if offset != f.offset && f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	f.offset = offset
+
+	return offset, nil
+}
+
+// openAt opens the stream of the file from offset.
+func (f *WeedFile) openAt(offset int64) error {
+	cm, err := f.chunkManifest()
+	if err != nil {
+		return err
+	}
+	if cm != nil {
+		if f.client.opts.ReadAheadChunks > 0 {
+			f.reader = newReadAheadReader(f, cm, offset, f.client.opts.ReadAheadChunks)
+		} else {
+			f.reader = &chunkReader{f: f, cm: cm, offset: offset}
+		}
+		return nil
+	}
+	if f.key != nil {
+		data, err := f.readSealed(f.ctx, f.Fid, f.locations, f.nonce, 0)
+		if err != nil {
+			return err
+		}
+		if offset > int64(len(data)) {
+			offset = int64(len(data))
+		}
+		f.reader = ioutil.NopCloser(bytes.NewReader(data[offset:]))
+		return nil
+	}
+
+	resp, err := f.getRange(f.ctx, f.Fid, f.locations, offset, -1)
+	if err == io.EOF {
+		f.reader = http.NoBody
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.reader = resp.Body
+	if offset == 0 {
+		f.reader = f.verify(resp)
+	}
+
+	return nil
+}
+
+// verify wraps the body of a whole file response to check the md5 recorded
+// on write, in the manifest of a chunked file or in the pair of a needle.
+// A body decompressed by the transport is checked by the plain md5 of a
+// needle compressed by the client, not checked if there is none.
+func (f *WeedFile) verify(resp *http.Response) io.ReadCloser {
+	if resp.Uncompressed {
+		if expected := resp.Header.Get(utils.PlainMd5Header); expected != "" {
+			return utils.NewVerifyReader(resp.Body, f.Fid, func() (string, error) {
+				return expected, nil
+			})
+		}
+		return resp.Body
+	}
+	if f.chunked {
+		return utils.NewVerifyReader(resp.Body, f.Fid, func() (string, error) {
+			cm, err := f.chunkManifest()
+			if err != nil {
+				return "", err
+			}
+			return cm.Md5, nil
+		})
+	}
+	if expected := resp.Header.Get(utils.Md5Header); expected != "" {
+		return utils.NewVerifyReader(resp.Body, f.Fid, func() (string, error) {
+			return expected, nil
+		})
+	}
+
+	return resp.Body
+}
+
+// setHeader sets the file attributes by the response of fileUrl.
+func (f *WeedFile) setHeader(fileUrl string, resp *http.Response) {
+	filename := utils.FileNameOf(resp.Header)
+	if filename == "" {
+		filename = f.Fid
+	}
+	f.FileName = filename
+	f.RealName = filename
+	f.FileUrl = fileUrl
+	f.chunked = resp.Header.Get("X-File-Store") == "chunked"
+	if !resp.Uncompressed {
+		f.size = resp.ContentLength
+	} else if size, err := strconv.ParseInt(resp.Header.Get(utils.SizeHeader), 10, 64); err == nil {
+		f.size = size // compressed by the client.
+	}
+}
+
+// readRangeAt reads len(p) bytes from off of the needle fid.
+func (f *WeedFile) readRangeAt(ctx context.Context, fid string, locations []utils.Location, p []byte, off int64) (int, error) {
+	resp, err := f.getRange(ctx, fid, locations, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+
+	return n, err
+}
+
+// getRange requests the range of the needle fid, tries the locations in
+// turn, or hedges the request to them if enabled. The body of the response
+// fails over to the other locations if it breaks.
+func (f *WeedFile) getRange(ctx context.Context, fid string, locations []utils.Location, offset, length int64) (*http.Response, error) {
+	var err error
+	var resp *http.Response
+	loc := 0
+	if f.client.opts.HedgeDelay > 0 && len(locations) > 1 {
+		resp, loc, err = f.hedgedRange(ctx, fid, locations, offset, length)
+	} else {
+		for i, location := range locations {
+			fileUrl := f.client.uc.FileUrl(location, fid)
+			resp, err = f.rangeOf(ctx, fileUrl, offset, length)
+			if err == nil || err == io.EOF {
+				loc = i
+				break
+			}
+			glog.V(4).Infof("Failed to read %s at %d, %v", fileUrl, offset, err)
+		}
+	}
+	if err == nil && resp != nil {
+		resp.Body = &failoverBody{
+			f:         f,
+			ctx:       ctx,
+			fid:       fid,
+			locations: locations,
+			loc:       loc,
+			whole:     resp.Uncompressed,
+			offset:    offset,
+			remaining: length,
+			rc:        resp.Body,
+		}
+	}
+	if resp == nil && err == nil {
+		err = fmt.Errorf("file %s %w", fid, ErrNotFound)
+	}
+
+	return resp, err
+}
+
+// rangeOf requests the range of fileUrl, as stored if the file is read raw.
+func (f *WeedFile) rangeOf(ctx context.Context, fileUrl string, offset, length int64) (*http.Response, error) {
+	if f.raw {
+		return f.client.uc.GetRangeRaw(ctx, fileUrl, offset, length)
+	}
+	return f.client.uc.GetRange(ctx, fileUrl, offset, length)
+}
+
+// failoverBody is the body of a range of the needle fid. If the stream
+// breaks, e.g. the volume server dies, it is reopened from the next byte
+// on the other locations in turn, so the reader never notices.
+type failoverBody struct {
+	f         *WeedFile
+	ctx       context.Context
+	fid       string
+	locations []utils.Location
+	loc       int   // the location of rc.
+	whole     bool  // decompressed by the transport, reopened from the start.
+	offset    int64 // offset of the next byte of rc in the needle.
+	remaining int64 // bytes left of the range, negative means to the end.
+	stalls    int   // failovers without any byte read since.
+	rc        io.ReadCloser
+	err       error // the stream broken on every location.
+}
+
+func (b *failoverBody) Read(p []byte) (int, error) {
+	for b.err == nil {
+		n, err := b.rc.Read(p)
+		if n > 0 {
+			b.offset += int64(n)
+			if b.remaining > 0 {
+				b.remaining -= int64(n)
+			}
+			b.stalls = 0
+		}
+		if err == nil || err == io.EOF || b.remaining == 0 || b.ctx.Err() != nil {
+			return n, err
+		}
+
+		b.err = b.reopen(err)
+		if n > 0 {
+			return n, b.err
+		}
+	}
+
+	return 0, b.err
+}
+
+// reopen opens the rest of the range on the next location after the
+// stream broke by cause, every location has a chance before giving up.
+func (b *failoverBody) reopen(cause error) error {
+	b.rc.Close()
+	b.rc = http.NoBody
+	for b.stalls < len(b.locations) {
+		b.stalls++
+		b.loc = (b.loc + 1) % len(b.locations)
+		fileUrl := b.f.client.uc.FileUrl(b.locations[b.loc], b.fid)
+		glog.V(4).Infof("Read of %s broken at %d, reopen on %s, %v", b.fid, b.offset, fileUrl, cause)
+
+		rc, err := b.open(fileUrl)
+		switch err {
+		case nil:
+			b.rc = rc
+			return nil
+		case io.EOF: // nothing left from the offset.
+			return nil
+		}
+		cause = err
+	}
+
+	return cause
+}
+
+func (b *failoverBody) open(fileUrl string) (io.ReadCloser, error) {
+	if !b.whole {
+		resp, err := b.f.rangeOf(b.ctx, fileUrl, b.offset, b.remaining)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	resp, err := b.f.rangeOf(b.ctx, fileUrl, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, resp.Body, b.offset); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (b *failoverBody) Close() error {
+	return b.rc.Close()
+}
+
+// chunkManifest returns the manifest of a chunked file, or nil for a plain
+// needle. The manifest is loaded once by cm=false.
+func (f *WeedFile) chunkManifest() (*utils.ChunkManifest, error) {
+	if !f.chunked {
+		return nil, nil
+	}
+
+	f.cmOnce.Do(func() {
+		var b []byte
+		for _, location := range f.locations {
+			manifestUrl := f.client.uc.FileUrl(location, f.Fid) + "?cm=false"
+			if b, f.cmErr = f.client.uc.Get(f.ctx, manifestUrl); f.cmErr == nil {
+				break
+			}
+		}
+		if f.cmErr == nil {
+			f.cm, f.cmErr = utils.LoadChunkManifest(b)
+		}
+	})
+
+	return f.cm, f.cmErr
+}
+
+// fileSize returns the size of the file, by the manifest for a chunked file,
+// and by a HEAD request if the size is not known yet.
+func (f *WeedFile) fileSize() (int64, error) {
+	if f.size >= 0 {
+		return f.size, nil
+	}
+
+	cm, err := f.chunkManifest()
+	if err != nil {
+		return 0, err
+	}
+	if cm != nil {
+		f.size = cm.Size
+		return f.size, nil
+	}
+
+	for _, location := range f.locations {
+		fileUrl := f.client.uc.FileUrl(location, f.Fid)
+		var resp *http.Response
+		if f.raw {
+			resp, err = f.client.head(f.ctx, fileUrl)
+		} else {
+			resp, err = f.client.uc.Head(f.ctx, fileUrl)
+		}
+		if err == nil {
+			if resp.ContentLength < 0 {
+				return 0, fmt.Errorf("unknown size of %s", f.Fid)
+			}
+			f.size = resp.ContentLength
+			return f.size, nil
+		}
+	}
+
+	return 0, err
+}
+
+// chunkReader streams a chunked file from offset, chunk by chunk.
+type chunkReader struct {
+	f      *WeedFile
+	cm     *utils.ChunkManifest
+	offset int64
+	rc     io.ReadCloser // stream of the current chunk.
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.rc == nil {
+			views := r.cm.ViewsAt(r.offset, r.cm.Size-r.offset)
+			if len(views) == 0 {
+				return 0, io.EOF
+			}
+			locations, err := r.f.client.lookupFileId(r.f.ctx, views[0].Fid)
+			if err != nil {
+				return 0, err
+			}
+			if r.rc, err = r.open(views[0], locations); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+			if views[0].Md5 != "" {
+				r.rc = utils.NewVerifyReader(r.rc, views[0].Fid, func() (string, error) {
+					return views[0].Md5, nil
+				})
+			}
+		}
+
+		n, err := r.rc.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.rc.Close()
+			r.rc = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// open opens the stream of the view, a chunk encrypted is read whole
+// and decrypted.
+func (r *chunkReader) open(view utils.ChunkView, locations []utils.Location) (io.ReadCloser, error) {
+	if r.f.key == nil {
+		resp, err := r.f.getRange(r.f.ctx, view.Fid, locations, view.Offset, view.Size)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	data := make([]byte, view.Size)
+	base := view.LogicOffset - view.Offset
+	n, err := r.f.readNeedleAt(r.f.ctx, view.Fid, locations, nonceOf(r.cm, view.Fid), base, data, view.Offset)
+	if err == io.EOF && int64(n) < view.Size {
+		err = io.ErrUnexpectedEOF // chunk shorter than the manifest said.
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.rc != nil {
+		return r.rc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package weedfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+func writeFile(t *testing.T, c *Client, opts *CreateOptions, data []byte) string {
+	f, err := c.CreateWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	return f.Fid
+}
+
+func TestReadAtAndSeek(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+
+	for name, chunkSize := range map[string]int64{"plain": -1, "chunked": 1000} {
+		fid := writeFile(t, c, &CreateOptions{Name: "a.txt", ChunkSize: chunkSize}, data)
+		f, err := c.Open(fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", name, err)
+		}
+		if f.chunked != (chunkSize > 0) {
+			t.Errorf("%s: Expect chunked %t", name, chunkSize > 0)
+		}
+
+		p := make([]byte, 1500)
+		if n, err := f.ReadAt(p, 900); err != nil || !bytes.Equal(p[:n], data[900:2400]) {
+			t.Errorf("%s: ReadAt mismatch, n %d, err %v", name, n, err)
+		}
+		if n, err := f.ReadAt(p, int64(len(data))-100); err != io.EOF || !bytes.Equal(p[:n], data[len(data)-100:]) {
+			t.Errorf("%s: ReadAt at the end expect %d bytes and EOF, but %d, %v", name, 100, n, err)
+		}
+
+		if off, err := f.Seek(-200, io.SeekEnd); err != nil || off != int64(len(data))-200 {
+			t.Fatalf("%s: Failed to seek: %d, %v", name, off, err)
+		}
+		b, err := ioutil.ReadAll(f)
+		if err != nil || !bytes.Equal(b, data[len(data)-200:]) {
+			t.Errorf("%s: Read after seek mismatch, %d bytes, err %v", name, len(b), err)
+		}
+
+		f.Seek(1999, io.SeekStart)
+		b, err = ioutil.ReadAll(io.LimitReader(f, 10))
+		if err != nil || !bytes.Equal(b, data[1999:2009]) {
+			t.Errorf("%s: Read across chunks mismatch %q, err %v", name, b, err)
+		}
+		f.Close()
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 100, ReadAheadChunks: 3})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	fid := writeFile(t, c, &CreateOptions{Name: "a.bin"}, data)
+
+	f, err := c.Open(fid, 1)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	if f.reader != nil {
+		t.Fatal("Expect the chunked file not streamed by the volume server.")
+	}
+
+	var b []byte
+	p := make([]byte, 30)
+	for {
+		n, err := f.Read(p)
+		b = append(b, p[:n]...)
+		if r, ok := f.reader.(*readAheadReader); ok && r.cur != nil && len(r.pending) >= r.window {
+			t.Fatalf("Expect at most %d chunks buffered, the one read included, but %d more", r.window, len(r.pending))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read: %v", err)
+		}
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("Read mismatch, %d bytes", len(b))
+	}
+	if _, ok := f.reader.(*readAheadReader); !ok {
+		t.Fatalf("Expect read ahead by the client, but %T", f.reader)
+	}
+	if f.RealName != "a.bin" || f.size != int64(len(data)) {
+		t.Errorf("Unexpected name %s or size %d", f.RealName, f.size)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	fc := newFakeCluster(t)
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+	sum := fmt.Sprintf("%x", md5.Sum(data))
+
+	for name, opts := range map[string]Options{
+		"plain":     {ChunkSize: 10000},
+		"chunked":   {ChunkSize: 1000},
+		"readahead": {ChunkSize: 1000, ReadAheadChunks: 2},
+	} {
+		c := fc.client(t, opts)
+		f, err := c.CreateWithOptions(context.Background(), &CreateOptions{Name: "a.bin"})
+		if err != nil {
+			t.Fatalf("%s: Failed to create: %v", name, err)
+		}
+		f.Write(data)
+		if err := f.Close(); err != nil {
+			t.Fatalf("%s: Failed to close: %v", name, err)
+		}
+		if f.Md5() != sum {
+			t.Errorf("%s: Expect md5 %s, but %s", name, sum, f.Md5())
+		}
+
+		victim := f.Fid
+		if name == "plain" {
+			if got := fc.needle(f.Fid).header.Get(utils.Md5Header); got != sum {
+				t.Errorf("%s: Expect md5 pair %s, but %s", name, sum, got)
+			}
+		} else {
+			cm, err := utils.LoadChunkManifest(fc.needle(f.Fid).data)
+			if err != nil {
+				t.Fatalf("%s: Failed to load manifest: %v", name, err)
+			}
+			if cm.Md5 != sum || cm.Chunks[1].Md5 != fmt.Sprintf("%x", md5.Sum(data[1000:2000])) {
+				t.Errorf("%s: Expect md5 recorded in manifest, but %+v", name, cm)
+			}
+			victim = cm.Chunks[1].Fid
+		}
+
+		r, err := c.Open(f.Fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", name, err)
+		}
+		if b, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(b, data) {
+			t.Errorf("%s: Expect content verified, but %v", name, err)
+		}
+		r.Close()
+
+		fc.needle(victim).data[10] ^= 1
+		r, err = c.Open(f.Fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", name, err)
+		}
+		if _, err := ioutil.ReadAll(r); err == nil {
+			t.Errorf("%s: Expect checksum mismatch", name)
+		} else if _, ok := err.(*ChecksumError); !ok {
+			t.Errorf("%s: Expect ChecksumError, but %v", name, err)
+		}
+		if name != "plain" {
+			if _, err := r.ReadAt(make([]byte, 1000), 1000); err == nil {
+				t.Errorf("%s: Expect ReadAt of the whole chunk verified", name)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestReadFailover(t *testing.T) {
+	fc := newFakeCluster(t)
+	data := utils.FakeBytes(100 << 10)
+
+	for _, opts := range []Options{{}, {ChunkSize: 30 << 10}, {ChunkSize: 30 << 10, ReadAheadChunks: 2}} {
+		c := fc.client(t, opts)
+		fid := writeFile(t, c, &CreateOptions{Name: "a.bin"}, data)
+
+		fc.setCuts(2)
+		if b := readFile(t, c, fid); !bytes.Equal(b, data) {
+			t.Errorf("%+v: Expect the content read by failover, but %d bytes", opts, len(b))
+		}
+
+		fc.setCuts(1000)
+		f, err := c.Open(fid, 1)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		if b, err := ioutil.ReadAll(f); err == nil || err == io.EOF {
+			t.Errorf("%+v: Expect the broken read failed, but %d bytes, %v", opts, len(b), err)
+		}
+		f.Close()
+		fc.setCuts(0)
+	}
+}
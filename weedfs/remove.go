@@ -0,0 +1,361 @@
+package weedfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+const DEFAULT_REMOVE_CONCURRENCY = 8
+
+// RemoveStatus is the outcome of removing a fid.
+type RemoveStatus int
+
+const (
+	RemoveDeleted RemoveStatus = iota
+	RemoveNotFound
+	RemoveFailed
+)
+
+func (s RemoveStatus) String() string {
+	switch s {
+	case RemoveDeleted:
+		return "deleted"
+	case RemoveNotFound:
+		return "not found"
+	default:
+		return "error"
+	}
+}
+
+// RemoveResult is the result of removing a fid.
+type RemoveResult struct {
+	Fid    string
+	Status RemoveStatus
+	Size   int64 // bytes deleted.
+	Error  error // the failure if Status is RemoveFailed.
+}
+
+func (r *RemoveResult) String() string {
+	if r.Error != nil {
+		return fmt.Sprintf("%s: %s, %v", r.Fid, r.Status, r.Error)
+	}
+	return fmt.Sprintf("%s: %s", r.Fid, r.Status)
+}
+
+// RemoveOptions controls a bulk remove.
+type RemoveOptions struct {
+	// Concurrency is the max number of volume servers requested
+	// concurrently, 0 means DEFAULT_REMOVE_CONCURRENCY.
+	Concurrency int
+}
+
+// RemoveMany removes the fids on the cluster of seeds, see Client.RemoveMany.
+func RemoveMany(ctx context.Context, seeds string, fids []string, opts *RemoveOptions) []*RemoveResult {
+	return defaultClient(seeds, "", "", "").RemoveMany(ctx, fids, opts)
+}
+
+// RemoveMany removes the fids by one request per volume server, every
+// replica of a fid is deleted. It returns a result per fid in order, a fid
+// is deleted if a replica is deleted and no replica failed, not found if
+// no replica has it.
+func (c *Client) RemoveMany(ctx context.Context, fids []string, opts *RemoveOptions) []*RemoveResult {
+	if opts == nil {
+		opts = &RemoveOptions{}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_REMOVE_CONCURRENCY
+	}
+
+	results := make([]*RemoveResult, len(fids))
+	byFid := make(map[string]*removeState)
+	vidToFids := make(map[string][]string)
+	var vids []string
+	for i, fid := range fids {
+		results[i] = &RemoveResult{Fid: fid}
+		if _, ok := byFid[fid]; ok {
+			continue
+		}
+		byFid[fid] = &removeState{}
+		vid, _, err := utils.ParseFileId(fid)
+		if err != nil {
+			byFid[fid].fail(err)
+			continue
+		}
+		if _, ok := vidToFids[vid]; !ok {
+			vids = append(vids, vid)
+		}
+		vidToFids[vid] = append(vidToFids[vid], fid)
+	}
+
+	serverToFids := make(map[string][]string)
+	if len(vids) > 0 {
+		lookups, lookupErr := c.uc.LookupVolumeIds(ctx, c.opts.Seeds, vids)
+		for _, vid := range vids {
+			locations, err := c.volumeLocations(ctx, vid, lookups, lookupErr)
+			if err != nil {
+				for _, fid := range vidToFids[vid] {
+					byFid[fid].fail(err)
+				}
+				continue
+			}
+			for _, location := range locations {
+				server := c.uc.Address(location)
+				serverToFids[server] = append(serverToFids[server], vidToFids[vid]...)
+			}
+		}
+	}
+
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for server, fidList := range serverToFids {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(server string, fidList []string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			c.removeOn(ctx, server, fidList, byFid)
+		}(server, fidList)
+	}
+	wg.Wait()
+
+	for _, r := range results {
+		byFid[r.Fid].result(r)
+	}
+
+	return results
+}
+
+// volumeLocations returns the locations of volume vid by the batch lookup
+// of all the volumes, which fails as a whole if any volume is not found,
+// the volume is looked up by itself then. A volume unknown to the master
+// has no locations, its fids are not found.
+func (c *Client) volumeLocations(ctx context.Context, vid string, lookups map[string]utils.LookupResult, err error) ([]utils.Location, error) {
+	if err == nil {
+		return lookups[vid].Locations, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	lookup, err := c.uc.Lookup(ctx, c.opts.Seeds, vid)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lookup.Locations, nil
+}
+
+// removeOn deletes the fids from the volume server, the fids failed
+// transiently are retried by the policy of utils.OpDelete.
+func (c *Client) removeOn(ctx context.Context, server string, fids []string, byFid map[string]*removeState) {
+	pending := fids
+	err := c.uc.RetryPolicy(utils.OpDelete).Do(ctx, utils.OpDelete, func() error {
+		var err error
+		pending, err = c.deleteOn(ctx, server, pending, byFid)
+		return err
+	})
+
+	for _, fid := range pending {
+		byFid[fid].fail(err)
+	}
+}
+
+// deleteOn deletes the fids from the volume server once. A fid failed
+// permanently fails at once, the fids failed transiently are returned
+// with the error to retry.
+func (c *Client) deleteOn(ctx context.Context, server string, fids []string, byFid map[string]*removeState) ([]string, error) {
+	results, err := c.uc.BatchDelete(ctx, server, fids)
+	if err != nil {
+		return fids, err
+	}
+
+	var pending []string
+	for _, r := range results {
+		state, ok := byFid[r.Fid]
+		if !ok {
+			continue
+		}
+		switch r.Status {
+		case http.StatusAccepted, http.StatusOK:
+			state.deleted(int64(r.Size))
+		case http.StatusNotFound:
+		default:
+			e := &ServerError{Url: fmt.Sprintf("http://%s/%s", server, r.Fid), StatusCode: r.Status, Message: r.Error}
+			if !utils.Retryable(utils.OpDelete, e) {
+				state.fail(e)
+				continue
+			}
+			pending = append(pending, r.Fid)
+			err = e
+		}
+	}
+
+	return pending, err
+}
+
+// removeState merges the results of a fid from its replicas.
+type removeState struct {
+	mu   sync.Mutex
+	done bool // deleted by any replica.
+	size int64
+	errs []error
+}
+
+func (s *removeState) deleted(size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	if size > s.size {
+		s.size = size
+	}
+}
+
+func (s *removeState) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+func (s *removeState) result(r *RemoveResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case len(s.errs) > 0:
+		r.Status = RemoveFailed
+		r.Error = utils.JoinErrors(s.errs)
+	case s.done:
+		r.Status = RemoveDeleted
+		r.Size = s.size
+	default:
+		r.Status = RemoveNotFound
+	}
+}
+
+// RemoveFileOptions controls the removal of a file.
+type RemoveFileOptions struct {
+	RemoveOptions // for the chunks of a chunked file.
+	// Verify checks that neither the file nor its chunks are still
+	// readable from any location after removed.
+	Verify bool
+}
+
+// RemoveReport reports the removal of a file.
+type RemoveReport struct {
+	Fid      string
+	Chunked  bool
+	Chunks   []*RemoveResult // the chunks of a chunked file.
+	Removed  bool            // the file itself is removed.
+	Readable []string        // fids still readable, only if verified.
+}
+
+// Failed returns the number of chunks failed to remove.
+func (r *RemoveReport) Failed() int {
+	failed := 0
+	for _, cr := range r.Chunks {
+		if cr.Status == RemoveFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+func (r *RemoveReport) String() string {
+	return fmt.Sprintf("Fid:%s, Removed:%t, Chunks:%d, Failed:%d, Readable:%d", r.Fid, r.Removed, len(r.Chunks), r.Failed(), len(r.Readable))
+}
+
+// partialError returns the error of the fids not removed or still readable.
+func (r *RemoveReport) partialError(total int) error {
+	e := &PartialDeleteError{Fid: r.Fid, Total: total}
+	for _, cr := range r.Chunks {
+		if cr.Status == RemoveFailed {
+			e.Failed = append(e.Failed, cr.Error)
+		}
+	}
+	for _, fid := range r.Readable {
+		e.Failed = append(e.Failed, fmt.Errorf("%s still readable after removed", fid))
+	}
+	return e
+}
+
+// RemoveWithOptions removes the file id on the cluster of seeds,
+// see Client.RemoveWithOptions.
+func RemoveWithOptions(ctx context.Context, seeds, id string, opts *RemoveFileOptions) (*RemoveReport, error) {
+	return defaultClient(seeds, "", "", "").RemoveWithOptions(ctx, id, opts)
+}
+
+// RemoveWithOptions removes the file id. The chunks of a chunked file are
+// deleted by batch delete before the manifest, if any chunk fails, the
+// manifest is kept so that the remove can be retried. If the file is not
+// found by stat, it is removed as a plain needle, the volume server deletes
+// the chunks of a manifest as well, any other failure of stat is returned.
+// The report covers the partial failures, the error is not nil unless
+// everything is removed.
+func (c *Client) RemoveWithOptions(ctx context.Context, id string, opts *RemoveFileOptions) (*RemoveReport, error) {
+	if opts == nil {
+		opts = &RemoveFileOptions{}
+	}
+	report := &RemoveReport{Fid: id}
+
+	var chunkFids []string
+	_, cm, _, err := c.stat(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		glog.V(4).Infof("Failed to stat %s, remove it as a plain needle, %v", id, err)
+	} else if err != nil {
+		return report, err
+	} else if cm != nil {
+		report.Chunked = true
+		for _, ci := range cm.Chunks {
+			chunkFids = append(chunkFids, ci.Fid)
+		}
+		report.Chunks = c.RemoveMany(ctx, chunkFids, &opts.RemoveOptions)
+		if report.Failed() > 0 {
+			return report, report.partialError(len(chunkFids))
+		}
+	}
+
+	if err := c.uc.DeleteFile(ctx, c.opts.Seeds, id); err != nil {
+		return report, err
+	}
+	report.Removed = true
+
+	if opts.Verify {
+		for _, fid := range append([]string{id}, chunkFids...) {
+			if c.readable(ctx, fid) {
+				report.Readable = append(report.Readable, fid)
+			}
+		}
+		if len(report.Readable) > 0 {
+			return report, report.partialError(len(chunkFids) + 1)
+		}
+	}
+	glog.V(4).Infof("Removed %s", report)
+
+	return report, nil
+}
+
+// readable returns true if fid is readable from any of its locations.
+func (c *Client) readable(ctx context.Context, fid string) bool {
+	locations, err := c.uc.LookupFileId(ctx, c.opts.Seeds, fid)
+	if err != nil {
+		return false
+	}
+	for _, location := range locations {
+		if _, err := c.head(ctx, c.uc.FileUrl(location, fid)); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package weedfs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+var (
+	fastDeletes = utils.RetryPolicies{utils.OpDelete: {MaxAttempts: 3, InitialBackoff: time.Millisecond}}
+	noDeletes   = utils.RetryPolicies{utils.OpDelete: utils.NoRetry}
+)
+
+func TestRemoveMany(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{Retry: fastDeletes})
+	a := writeFile(t, c, &CreateOptions{Name: "a.txt", ChunkSize: -1}, []byte("aaa"))
+	b := writeFile(t, c, &CreateOptions{Name: "b.txt", ChunkSize: -1}, []byte("bb"))
+	fc.failures = 1 // retried.
+
+	fids := []string{a, b, "3,ffffffff", "malformed", a}
+	results := c.RemoveMany(context.Background(), fids, nil)
+	expect := []RemoveStatus{RemoveDeleted, RemoveDeleted, RemoveNotFound, RemoveFailed, RemoveDeleted}
+	if len(results) != len(fids) {
+		t.Fatalf("Expect %d results, but %d", len(fids), len(results))
+	}
+	for i, r := range results {
+		if r.Fid != fids[i] || r.Status != expect[i] {
+			t.Errorf("Expect %s %s, but %s", fids[i], expect[i], r)
+		}
+	}
+	if results[0].Size != 3 || results[3].Error == nil {
+		t.Errorf("Unexpected results %v", results)
+	}
+	if fc.needle(a) != nil || fc.needle(b) != nil {
+		t.Error("Expect files removed")
+	}
+
+	fc.failures = 10
+	results = fc.client(t, Options{Retry: noDeletes}).RemoveMany(context.Background(), []string{b}, nil)
+	if results[0].Status != RemoveFailed {
+		t.Errorf("Expect failed without retry, but %s", results[0])
+	}
+
+	d := writeFile(t, c, &CreateOptions{Name: "d.txt", ChunkSize: -1}, []byte("d"))
+	fc.failures, fc.failWith = 1, http.StatusBadRequest // not retried.
+	results = c.RemoveMany(context.Background(), []string{d}, nil)
+	if results[0].Status != RemoveFailed || fc.needle(d) == nil {
+		t.Errorf("Expect failed permanently, but %s", results[0])
+	}
+
+	e := writeFile(t, c, &CreateOptions{Name: "e.txt", ChunkSize: -1}, []byte("e"))
+	results = c.RemoveMany(context.Background(), []string{e, "9,0123abcd"}, nil) // volume 9 unknown.
+	if results[0].Status != RemoveDeleted || results[1].Status != RemoveNotFound {
+		t.Errorf("Expect deleted and not found, but %v", results)
+	}
+}
+
+func TestRemoveChunked(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 100, Retry: fastDeletes})
+	data := make([]byte, 350)
+
+	fid := writeFile(t, c, &CreateOptions{Name: "a.bin"}, data)
+	fc.failures = 10
+	report, err := fc.client(t, Options{Retry: noDeletes}).RemoveWithOptions(context.Background(), fid, nil)
+	if err == nil || report.Removed || report.Failed() != 4 {
+		t.Errorf("Expect the chunks failed, but %s, %v", report, err)
+	}
+	if fc.needle(fid) == nil {
+		t.Error("Expect the manifest kept after the chunks failed")
+	}
+
+	fc.failures = 0
+	report, err = c.RemoveWithOptions(context.Background(), fid, &RemoveFileOptions{Verify: true})
+	if err != nil || !report.Removed || !report.Chunked || len(report.Chunks) != 4 || report.Failed() != 0 {
+		t.Fatalf("Expect removed, but %s, %v", report, err)
+	}
+	for _, r := range report.Chunks {
+		if r.Status != RemoveDeleted || fc.needle(r.Fid) != nil {
+			t.Errorf("Expect chunk deleted, but %s", r)
+		}
+	}
+	if fc.needle(fid) != nil {
+		t.Error("Expect the manifest deleted")
+	}
+}
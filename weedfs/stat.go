@@ -0,0 +1,151 @@
+package weedfs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+
+	"jingoal.com/seaweedfs-adaptor/utils"
+)
+
+// FileInfo is the metadata of a file.
+type FileInfo struct {
+	Fid          string
+	Name         string
+	MimeType     string
+	Size         int64 // the stored size, of the gzipped or encrypted content.
+	LogicalSize  int64 // the size of the plaintext decompressed, -1 if unknown.
+	ETag         string
+	LastModified time.Time // zero if unknown.
+	IsGzipped    bool
+	Encrypted    bool
+	Chunked      bool
+	Chunks       int    // number of chunks of a chunked file.
+	Md5          string // md5 recorded on write, empty if unknown.
+	PlainMd5     string // md5 decompressed of a needle compressed by the client.
+}
+
+func (fi *FileInfo) String() string {
+	return fmt.Sprintf("Fid:%s, Name:%s, MimeType:%s, Size:%d, Chunked:%t, Chunks:%d", fi.Fid, fi.Name, fi.MimeType, fi.Size, fi.Chunked, fi.Chunks)
+}
+
+// Stat returns the metadata of the file without downloading it.
+func Stat(id string, domain int64, seeds string) (*FileInfo, error) {
+	return StatContext(context.Background(), id, domain, seeds)
+}
+
+// StatContext is like Stat but every request is bound to ctx.
+func StatContext(ctx context.Context, id string, domain int64, seeds string) (*FileInfo, error) {
+	return defaultClient(seeds, "", "", "").StatContext(ctx, id, domain)
+}
+
+// Stat returns the metadata of the file, see StatContext.
+func (c *Client) Stat(id string, domain int64) (*FileInfo, error) {
+	return c.StatContext(context.Background(), id, domain)
+}
+
+// StatContext returns the metadata of the file by a HEAD request,
+// the manifest of a chunked file is fetched for its size and chunks.
+func (c *Client) StatContext(ctx context.Context, id string, domain int64) (*FileInfo, error) {
+	fi, _, _, err := c.stat(ctx, id)
+	return fi, err
+}
+
+// stat returns the metadata, the manifest if chunked, and the locations of id.
+func (c *Client) stat(ctx context.Context, id string) (*FileInfo, *utils.ChunkManifest, []utils.Location, error) {
+	locations, err := c.lookupFileId(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var resp *http.Response
+	for _, location := range locations {
+		fileUrl := c.uc.FileUrl(location, id)
+		if resp, err = c.head(ctx, fileUrl); err == nil {
+			break
+		}
+		glog.V(4).Infof("Failed to stat %s, %v", fileUrl, err)
+	}
+	if resp == nil && err == nil {
+		err = fmt.Errorf("file %s %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fi := &FileInfo{
+		Fid:       id,
+		Name:      utils.FileNameOf(resp.Header),
+		MimeType:  resp.Header.Get("Content-Type"),
+		Size:      resp.ContentLength,
+		ETag:      resp.Header.Get("Etag"),
+		IsGzipped: resp.Header.Get("Content-Encoding") == "gzip",
+		Encrypted: resp.Header.Get(KeyHeader) != "",
+		Chunked:   resp.Header.Get("X-File-Store") == "chunked",
+		Md5:       resp.Header.Get(utils.Md5Header),
+		PlainMd5:  resp.Header.Get(utils.PlainMd5Header),
+	}
+	fi.LogicalSize = fi.Size
+	if fi.IsGzipped || fi.Encrypted {
+		fi.LogicalSize = -1
+		if size, err := strconv.ParseInt(resp.Header.Get(utils.SizeHeader), 10, 64); err == nil {
+			fi.LogicalSize = size // compressed or encrypted by the client.
+		}
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		fi.LastModified, _ = http.ParseTime(lm)
+	}
+
+	var cm *utils.ChunkManifest
+	if fi.Chunked {
+		f := &WeedFile{
+			Fid:       id,
+			readFlag:  true,
+			client:    c,
+			seeds:     c.opts.Seeds,
+			locations: locations,
+			chunked:   true,
+			ctx:       ctx,
+		}
+		if cm, err = f.chunkManifest(); err != nil {
+			return nil, nil, nil, err
+		}
+		fi.Size = cm.Size
+		fi.LogicalSize = cm.Size
+		fi.Chunks = len(cm.Chunks)
+		fi.Md5 = cm.Md5
+		if fi.Name == "" {
+			fi.Name = cm.Name
+		}
+		if fi.MimeType == "" {
+			fi.MimeType = cm.Mime
+		}
+	}
+
+	return fi, cm, locations, nil
+}
+
+// head requests the headers of fileUrl as stored, a gzipped needle
+// is not decompressed by the volume server.
+func (c *Client) head(ctx context.Context, fileUrl string) (*http.Response, error) {
+	req, err := http.NewRequest("HEAD", fileUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.uc.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, &ServerError{Url: fileUrl, Err: err}
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ServerError{Url: fileUrl, StatusCode: resp.StatusCode}
+	}
+
+	return resp, nil
+}
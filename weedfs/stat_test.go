@@ -0,0 +1,35 @@
+package weedfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	fc := newFakeCluster(t)
+	c := fc.client(t, Options{ChunkSize: 1000})
+	data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuvwxyz"), 100)
+
+	for name, chunkSize := range map[string]int64{"plain": 10000, "chunked": 1000} {
+		fid := writeFile(t, c, &CreateOptions{Name: "a.txt", ChunkSize: chunkSize}, data)
+		fi, err := c.Stat(fid, 1)
+		if err != nil {
+			t.Fatalf("%s: Failed to stat: %v", name, err)
+		}
+		if fi.Name != "a.txt" || fi.Size != int64(len(data)) || fi.MimeType == "" || fi.Md5 == "" {
+			t.Errorf("%s: Unexpected %s, md5 %q", name, fi, fi.Md5)
+		}
+		if !fi.LastModified.Equal(fakeModTime) || fi.ETag == "" {
+			t.Errorf("%s: Expect Last-Modified %v and ETag, but %v %q", name, fakeModTime, fi.LastModified, fi.ETag)
+		}
+		if chunked := chunkSize < int64(len(data)); fi.Chunked != chunked {
+			t.Errorf("%s: Expect chunked %t", name, chunked)
+		} else if chunked && fi.Chunks != 4 {
+			t.Errorf("%s: Expect 4 chunks, but %d", name, fi.Chunks)
+		}
+	}
+
+	if _, err := c.Stat("3,ffffffff", 1); err == nil {
+		t.Error("Expect stat of a missing file failed")
+	}
+}
@@ -6,15 +6,20 @@ package weedfs
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
-	"mime"
+	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/golang/glog"
 
@@ -23,16 +28,22 @@ import (
 
 const (
 	MAX_CHUNK_SIZE = int64(1 * 1024 * 1024)
+
+	DEFAULT_INFLIGHT_CHUNKS = 4
 )
 
 var (
-	weedChunkSize int64
-	defaultTTL    string
+	errAborted = errors.New("upload aborted")
+
+	weedChunkSize  int64
+	defaultTTL     string
+	inflightChunks int
 )
 
 func init() {
 	flag.Int64Var(&weedChunkSize, "weed-chunk-size", 512*1024, "upload chunk size in bytes")
 	flag.StringVar(&defaultTTL, "default-ttl", "26w", "default TTL")
+	flag.IntVar(&inflightChunks, "weed-inflight-chunks", DEFAULT_INFLIGHT_CHUNKS, "max number of chunks uploading concurrently per file")
 }
 
 type WeedFile struct {
@@ -45,18 +56,55 @@ type WeedFile struct {
 	Size      int64 // upload bytes size.
 	TTL       string
 
+	// StoredSize is the bytes stored of the content, less than Size
+	// if compressed by the client.
+	StoredSize int64
+	Compressed bool // gzipped by the client on upload.
+	Encrypted  bool // sealed by the data key of the file.
+
 	buf       *bytes.Buffer
 	split     bool               // chunkSize>0 and upload.size>chunkSize, split is true.
 	hasErr    bool               // when has error, need delete all uploaded chunks.
 	chunkInfo []*utils.ChunkInfo // upload chunk info
-
-	reader   io.ReadCloser // download stream.
-	readFlag bool          // distinguish read or write, will do difference close.
-
+	base      int                // leading chunks of the version appended to, never deleted.
+	pipeline  *chunkPipeline     // uploads the chunks in background.
+	submitted int                // number of chunks submitted to pipeline.
+	inflight  int                // max number of chunks uploading concurrently.
+	journal   *journal           // records the session for resume, nil if disabled.
+	md5       hash.Hash          // md5 of the content written, nil if unknown.
+	replaced  []string           // chunks of the version overwritten, deleted on commit.
+	compress  *CompressionPolicy // gzips the content of a single needle, nil never.
+	key       *fileKey           // encrypts the content, nil if plaintext.
+	domain    int64              // of the key.
+
+	stream     *io.PipeWriter // streams the content if never split.
+	gz         *gzip.Writer   // compresses the stream, nil if not compressed.
+	streamRet  chan error     // result of the streamed upload.
+	expectSize int64          // content size if known, 0 means unknown.
+	pairs      http.Header    // needle pairs of the stream, kept by a copy.
+
+	reader    io.ReadCloser    // download stream, nil after Seek.
+	readFlag  bool             // distinguish read or write, will do difference close.
+	raw       bool             // read a gzipped needle as stored.
+	nonce     []byte           // of the needle encrypted.
+	plain     plainCache       // the needle decrypted last.
+	offset    int64            // offset of the next Read.
+	size      int64            // file size, -1 if unknown yet.
+	chunked   bool             // the file is a chunk manifest.
+	locations []utils.Location // locations of the file.
+	cm        *utils.ChunkManifest
+	cmErr     error
+	cmOnce    sync.Once
+
+	ctx context.Context // bound to every request made on behalf of the file.
+
+	client      *Client
 	seeds       string
 	replication string // replica strategy
+	collection  string
 	dataCenter  string
 	rack        string
+	dataNode    string
 	chunkSize   int64
 }
 
@@ -68,6 +116,15 @@ func (f *WeedFile) SetChunkSize(size int64) {
 	f.chunkSize = size
 }
 
+// Md5 returns the md5 of the content written so far in hex,
+// or empty if unknown, e.g. the file is resumed or opened for read.
+func (f *WeedFile) Md5() string {
+	if f.md5 == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", f.md5.Sum(nil))
+}
+
 func (f *WeedFile) String() string {
 	return fmt.Sprintf("Fid:%s, FileName:%s, IsGzipped:%t, MimeType:%s, FileUrl:%s, TTL:%s", f.Fid, f.RealName, f.IsGzipped, f.MimeType, f.FileUrl, f.TTL)
 }
@@ -75,10 +132,20 @@ func (f *WeedFile) String() string {
 // Read reads atmost len(p) bytes into p.
 // Returns number of bytes read and an error if any.
 func (f *WeedFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		if err := f.openAt(f.offset); err != nil {
+			return 0, err
+		}
+	}
+
 	nr, err := f.reader.Read(p)
 	if nr <= 0 {
-		return 0, io.EOF
+		if err == nil || err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, err // e.g. a checksum mismatch found at the end.
 	}
+	f.offset += int64(nr)
 
 	return nr, err
 }
@@ -89,6 +156,13 @@ func (f *WeedFile) Write(p []byte) (int, error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if f.md5 != nil {
+		f.md5.Write(p)
+	}
+
+	if f.chunkSize <= 0 && f.key == nil { // never split, stream to the volume server.
+		return f.writeStream(p)
+	}
 
 	var err error
 	if f.chunkSize > 0 && int64(f.buf.Len()+len(p)) > f.chunkSize { // need split chunk
@@ -110,7 +184,6 @@ func (f *WeedFile) Write(p []byte) (int, error) {
 				if _, err := f.UploadChunk(); err != nil {
 					return 0, err
 				}
-				f.buf.Reset()
 			} else {
 				i-- // not write full, retry again
 			}
@@ -130,10 +203,60 @@ func (f *WeedFile) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// writeStream writes p to the upload stream, the upload starts by
+// the first write and ends by Close. The md5 is not known until the
+// upload ends, so a streamed needle is stored without it.
+func (f *WeedFile) writeStream(p []byte) (int, error) {
+	if f.stream == nil {
+		pr, pw := io.Pipe()
+		gzipped := f.IsGzipped
+		uopts := &utils.UploadOptions{Size: f.expectSize, Header: make(http.Header)}
+		for k, v := range f.pairs {
+			uopts.Header[k] = v
+		}
+		if f.compress != nil && f.compress.worth(f.expectSize) {
+			gz, err := gzip.NewWriterLevel(countWriter{pw, &f.StoredSize}, f.compress.level())
+			if err != nil {
+				return 0, err
+			}
+			if f.expectSize > 0 {
+				uopts.Header.Set(utils.SizeHeader, strconv.FormatInt(f.expectSize, 10))
+			}
+			f.gz, f.Compressed, gzipped, uopts.Size = gz, true, true, 0
+		}
+		f.stream = pw
+		f.streamRet = make(chan error, 1)
+		go func() {
+			_, err := f.client.uc.UploadWithOptions(f.ctx, utils.SanitizeTTL(f.FileUrl, f.TTL), f.FileName, pr, gzipped, f.MimeType, uopts)
+			pr.CloseWithError(err) // fail the writes if the upload failed.
+			f.streamRet <- err
+		}()
+	}
+
+	var n int
+	var err error
+	if f.gz != nil {
+		n, err = f.gz.Write(p)
+	} else {
+		n, err = f.stream.Write(p)
+		f.StoredSize += int64(n)
+	}
+	f.Size += int64(n)
+	if err != nil {
+		f.hasErr = true
+		return n, err
+	}
+
+	return n, nil
+}
+
 // Close closes an open WeedFile.
 // Returns an error on failure.
 func (f *WeedFile) Close() error {
 	if f.readFlag { // read
+		if f.reader == nil {
+			return nil
+		}
 		if err := f.reader.Close(); err != nil {
 			return err
 		}
@@ -143,90 +266,252 @@ func (f *WeedFile) Close() error {
 
 	if f.hasErr {
 		f.buf.Reset()
-		f.DeleteChunks() // if has upload chunk, need to delete.
-		return nil
+		if f.stream != nil {
+			f.stream.CloseWithError(errAborted)
+			err := <-f.streamRet
+			f.endJournal(false)
+			return err
+		}
+		err := f.waitChunks()
+		f.abort()
+		return err
 	}
 
-	if !f.split { // splitSize == 0 or not great than splitSize
-		_, err := utils.Upload(utils.SanitizeTTL(f.FileUrl, f.TTL), f.FileName, bytes.NewReader(f.buf.Bytes()), f.IsGzipped, f.MimeType)
-		if err != nil {
+	if f.stream != nil {
+		var gzErr error
+		if f.gz != nil {
+			gzErr = f.gz.Close()
+		}
+		f.stream.CloseWithError(gzErr)
+		if err := <-f.streamRet; err != nil {
+			f.endJournal(false)
 			glog.Warningf("Failed to upload %s to %s, %v", f.RealName, f.FileUrl, err)
 			return err
 		}
+		f.endJournal(true)
 		glog.V(4).Infof("Succeeded to upload %s to %s.", f.RealName, f.FileUrl)
 		return nil
 	}
 
-	if f.buf.Len() > 0 { // the last chunk
-		_, err := f.UploadChunk()
-		f.buf.Reset()
+	if !f.split { // splitSize == 0 or not great than splitSize
+		data, gzipped := f.buf.Bytes(), f.IsGzipped
+		opts := &utils.UploadOptions{Header: make(http.Header)}
+		if f.compress != nil && len(data) > 0 && f.compress.worth(int64(len(data))) {
+			gz, err := f.compress.gzipBytes(data)
+			if err != nil {
+				f.endJournal(false)
+				return err
+			}
+			opts.Header.Set(utils.SizeHeader, strconv.Itoa(len(data)))
+			opts.Header.Set(utils.PlainMd5Header, utils.Md5Hex(data))
+			data, gzipped, f.Compressed = gz, true, true
+		}
+		if f.key != nil { // sealed whole, a gzipped content is read as stored.
+			sealed, nonce, err := f.key.seal(data, 0)
+			if err != nil {
+				f.endJournal(false)
+				return err
+			}
+			f.key.sealHeader(opts.Header, nonce, len(data))
+			data, gzipped = sealed, false
+		}
+		// The md5 is of the content stored, gzipped or not, the one
+		// decompressed is checked by the plain md5.
+		opts.Header.Set(utils.Md5Header, utils.Md5Hex(data))
+		_, err := f.client.uc.UploadWithOptions(f.ctx, utils.SanitizeTTL(f.FileUrl, f.TTL), f.FileName, bytes.NewReader(data), gzipped, f.MimeType, opts)
 		if err != nil {
-			f.DeleteChunks()
+			f.endJournal(false)
 			glog.Warningf("Failed to upload %s to %s, %v", f.RealName, f.FileUrl, err)
 			return err
 		}
+		f.Size += int64(f.buf.Len())
+		f.StoredSize = int64(len(data))
+		f.endJournal(true)
+		glog.V(4).Infof("Succeeded to upload %s to %s.", f.RealName, f.FileUrl)
+		return nil
+	}
+
+	var err error
+	if f.buf.Len() > 0 { // the last chunk
+		_, err = f.UploadChunk()
+	}
+	if werr := f.waitChunks(); err == nil {
+		err = werr
+	}
+	if err != nil {
+		f.abort()
+		glog.Warningf("Failed to upload %s to %s, %v", f.RealName, f.FileUrl, err)
+		return err
 	}
 
 	if err := f.UploadManifest(); err != nil {
-		f.DeleteChunks()
+		f.abort()
 		glog.Warningf("Failed to upload %s to %s, %v", f.RealName, f.FileUrl, err)
 		return err
 	}
+	f.StoredSize = f.Size
+	f.endJournal(true)
 	glog.V(4).Infof("Succeeded to upload %s to %s.", f.RealName, f.FileUrl)
 
 	return nil
 }
 
+// DeleteChunks removes all uploaded chunks, the chunks of the version
+// appended to are kept. It is a cleanup and deliberately not bound to
+// the file context, which may be done already.
 func (f *WeedFile) DeleteChunks() error {
-	delErr := 0
-	for _, ci := range f.chunkInfo {
-		if err := utils.DeleteFile(f.seeds, ci.Fid); err != nil {
-			delErr++
+	var errs []error
+	for _, ci := range f.chunkInfo[f.base:] {
+		if err := f.client.uc.DeleteFile(context.Background(), f.seeds, ci.Fid); err != nil {
+			errs = append(errs, err)
 			glog.Warningf("Failed to remove %s from %s, %v", ci.Fid, f.seeds, err)
 		}
 	}
-	if delErr > 0 {
-		return errors.New("Not all chunks deleted.")
+	if len(errs) > 0 {
+		return &PartialDeleteError{Fid: f.Fid, Total: len(f.chunkInfo) - f.base, Failed: errs}
 	}
 
 	return nil
 }
 
+// UploadChunk submits the buffered content as the next chunk, the chunk
+// is uploaded in background while the file keeps accepting data.
+// Returns the bytes size submitted so far, or the first upload failure.
 func (f *WeedFile) UploadChunk() (retSize int64, err error) {
-	chunkIdx := len(f.chunkInfo)
-	fname := fmt.Sprintf("%s-%s", f.Fid, strconv.Itoa(chunkIdx+1))
-	fid, count, err := f.uploadChunk(fname)
+	if f.pipeline == nil {
+		f.pipeline = newChunkPipeline(f.ctx, f.inflight)
+	}
+
+	fname := fmt.Sprintf("%s-%s", f.Fid, strconv.Itoa(len(f.chunkInfo)+f.submitted+1))
+	data := f.buf.Bytes()
+	f.buf = bytes.NewBuffer(make([]byte, 0, f.chunkSize))
+	offset := f.Size
+	ci := &utils.ChunkInfo{Offset: offset}
+	err = f.pipeline.submit(ci, data, func(ctx context.Context, data []byte) (string, int64, error) {
+		size := int64(len(data))
+		if f.key != nil { // authenticated by the seal, the md5 of the plaintext is never stored.
+			var err error
+			if data, ci.Nonce, err = f.key.seal(data, offset); err != nil {
+				return "", 0, err
+			}
+		} else {
+			ci.Md5 = utils.Md5Hex(data)
+		}
+		fid, count, err := f.uploadChunk(ctx, fname, data)
+		if f.key == nil {
+			size = int64(count)
+		}
+		if err == nil && f.journal != nil {
+			ci := &utils.ChunkInfo{Fid: fid, Offset: offset, Size: size, Md5: ci.Md5, Nonce: ci.Nonce}
+			if jerr := f.journal.append(&journalRecord{Type: recordChunk, Chunk: ci, Source: offset + ci.Size}); jerr != nil {
+				glog.Warningf("Failed to journal chunk %s of %s, %v", fid, f.Fid, jerr)
+			}
+		}
+		return fid, size, err
+	})
 	if err != nil {
 		f.hasErr = true
 		return 0, err
 	}
-
-	f.chunkInfo = append(f.chunkInfo, &utils.ChunkInfo{
-		Offset: int64(chunkIdx) * f.chunkSize,
-		Size:   int64(count),
-		Fid:    fid,
-	})
-	f.Size += int64(count)
+	f.submitted++
+	f.Size += int64(len(data))
 
 	return f.Size, nil
 }
 
-func (f *WeedFile) uploadChunk(filename string) (fid string, size uint32, e error) {
+// abort deletes the uploaded chunks, if not all the chunks are deleted,
+// the journal is left to the sweeper.
+func (f *WeedFile) abort() {
+	if err := f.DeleteChunks(); err != nil && f.journal != nil { // if has upload chunk, need to delete.
+		f.journal.append(&journalRecord{Type: recordAbort})
+		f.journal.close()
+		f.journal = nil
+		return
+	}
+	f.endJournal(false)
+}
+
+// endJournal ends the session recorded in the journal. A committed session
+// deletes the chunks of the version it replaced, if not all the chunks
+// are deleted, the journal is left to the sweeper.
+func (f *WeedFile) endJournal(committed bool) {
+	if committed && f.journal != nil {
+		f.journal.append(&journalRecord{Type: recordCommit})
+	}
+	if committed && len(f.replaced) > 0 {
+		if err := f.deleteReplaced(); err != nil {
+			glog.Warningf("Failed to remove the chunks replaced of %s, %v", f.Fid, err)
+			if f.journal != nil {
+				f.journal.close()
+				f.journal = nil
+			}
+			return
+		}
+	}
+	if f.journal == nil {
+		return
+	}
+	if err := f.journal.remove(); err != nil {
+		glog.Warningf("Failed to remove journal of %s, %v", f.Fid, err)
+	}
+	f.journal = nil
+}
+
+// deleteReplaced removes the chunks of the version overwritten, a chunk
+// not found is removed already. Like DeleteChunks, it is not bound to
+// the file context.
+func (f *WeedFile) deleteReplaced() error {
+	var errs []error
+	for _, r := range f.client.RemoveMany(context.Background(), f.replaced, nil) {
+		if r.Status == RemoveFailed {
+			errs = append(errs, r.Error)
+		}
+	}
+	if len(errs) > 0 {
+		return &PartialDeleteError{Fid: f.Fid, Total: len(f.replaced), Failed: errs}
+	}
+	f.replaced = nil
+
+	return nil
+}
+
+// waitChunks waits for the submitted chunks and collects them into chunkInfo.
+func (f *WeedFile) waitChunks() error {
+	if f.pipeline == nil {
+		return nil
+	}
+
+	chunks, err := f.pipeline.wait()
+	f.chunkInfo = append(f.chunkInfo, chunks...)
+	f.pipeline = nil
+	f.submitted = 0
+
+	return err
+}
+
+func (f *WeedFile) uploadChunk(ctx context.Context, filename string, data []byte) (fid string, size uint32, e error) {
 	ar := &utils.VolumeAssignRequest{
 		Count:       1,
 		Replication: f.replication,
+		Collection:  f.collection,
 		DataCenter:  f.dataCenter,
 		Rack:        f.rack,
+		DataNode:    f.dataNode,
 		Ttl:         f.TTL,
 	}
-	ret, err := utils.Assign(f.seeds, ar)
+	ret, err := f.client.uc.Assign(ctx, f.seeds, ar)
 	if err != nil {
 		return "", 0, err
 	}
+	if f.journal != nil {
+		if err := f.journal.append(&journalRecord{Type: recordAssign, Fid: ret.Fid}); err != nil {
+			glog.Warningf("Failed to journal chunk %s of %s, %v", ret.Fid, f.Fid, err)
+		}
+	}
 
-	fileUrl := utils.SanitizeTTL(fmt.Sprintf("http://%s/%s", ret.PublicUrl, ret.Fid), utils.AdjustTTL(f.TTL))
+	fileUrl := utils.SanitizeTTL(f.client.uc.FileUrl(ret.Location(), ret.Fid), utils.AdjustTTL(f.TTL))
 	glog.V(4).Infof("Uploading chunk %s to %s...", filename, fileUrl)
-	uploadRet, err := utils.Upload(fileUrl, filename, bytes.NewReader(f.buf.Bytes()), false, "application/octet-stream")
+	uploadRet, err := f.client.uc.Upload(ctx, fileUrl, filename, bytes.NewReader(data), false, "application/octet-stream")
 	if err != nil {
 		return ret.Fid, 0, err
 	}
@@ -239,8 +524,13 @@ func (f *WeedFile) UploadManifest() error {
 		Name:   f.RealName,
 		Size:   f.Size,
 		Mime:   f.MimeType,
+		Md5:    f.Md5(),
 		Chunks: f.chunkInfo[0:len(f.chunkInfo)],
 	}
+	if f.key != nil {
+		cm.Key = f.key.wrapped
+		cm.Md5 = "" // of the plaintext, never stored in the clear.
+	}
 
 	err := f.uploadManifest(&cm)
 	if err != nil {
@@ -265,7 +555,11 @@ func (f *WeedFile) uploadManifest(manifest *utils.ChunkManifest) error {
 		q.Set("ttl", f.TTL)
 	}
 	u.RawQuery = q.Encode()
-	_, err = utils.Upload(u.String(), manifest.Name, br, false, "application/json")
+	opts := &utils.UploadOptions{Header: make(http.Header)}
+	if manifest.Key != nil { // tells the file encrypted without the manifest.
+		opts.Header.Set(KeyHeader, base64.StdEncoding.EncodeToString(manifest.Key))
+	}
+	_, err = f.client.uc.UploadWithOptions(f.ctx, u.String(), manifest.Name, br, false, "application/json", opts)
 
 	return err
 }
@@ -273,70 +567,57 @@ func (f *WeedFile) uploadManifest(manifest *utils.ChunkManifest) error {
 // Create call with SeaWeedFS interface, create standard io.Writer.
 // Provide the stream operation of file for upload.
 func Create(name string, domain int64, seeds, replication, dc, rack string, chunkSize int64) (*WeedFile, error) {
-	return create(name, domain, seeds, replication, dc, rack, chunkSize, defaultTTL)
+	return CreateContext(context.Background(), name, domain, seeds, replication, dc, rack, chunkSize)
 }
 
-func create(name string, domain int64, seeds, replication, dc, rack string, chunkSize int64, ttl string) (*WeedFile, error) {
-	if weedChunkSize > MAX_CHUNK_SIZE {
-		weedChunkSize = MAX_CHUNK_SIZE
-		glog.Warningf("weed-chunk-size is set too large, use %d instead.", MAX_CHUNK_SIZE)
-	}
+// CreateContext is like Create but the file is bound to ctx,
+// assign and every chunk and manifest upload is aborted once ctx is done.
+func CreateContext(ctx context.Context, name string, domain int64, seeds, replication, dc, rack string, chunkSize int64) (*WeedFile, error) {
+	return defaultClient(seeds, replication, dc, rack).CreateWithOptions(ctx, &CreateOptions{
+		Name:      name,
+		Domain:    domain,
+		ChunkSize: chunkSize,
+	})
+}
 
-	ret := &WeedFile{
-		readFlag:    false,
-		seeds:       seeds,
-		replication: replication,
-		dataCenter:  dc,
-		rack:        rack,
-		chunkSize:   weedChunkSize,
-		Size:        0,
-		buf:         bytes.NewBuffer(nil),
-		split:       false,
-		hasErr:      false,
-		chunkInfo:   make([]*utils.ChunkInfo, 0),
-		TTL:         ttl,
-	}
+// CreateWithOptions creates the file specified by opts on the cluster of seeds,
+// the unset options fall back to the command line flags.
+func CreateWithOptions(ctx context.Context, seeds string, opts *CreateOptions) (*WeedFile, error) {
+	return defaultClient(seeds, "", "", "").CreateWithOptions(ctx, opts)
+}
 
-	ar := &utils.VolumeAssignRequest{
-		Count:       1,
-		Replication: ret.replication,
-		DataCenter:  ret.dataCenter,
-		Rack:        ret.rack,
-		Ttl:         ret.TTL,
-	}
-	aRet, err := utils.Assign(ret.seeds, ar)
-	if err != nil {
-		return nil, err
-	}
-	ret.Fid = aRet.Fid
-	ret.FileName = aRet.Fid
-	ret.RealName = aRet.Fid
-	ret.FileUrl = fmt.Sprintf("http://%s/%s", aRet.PublicUrl, aRet.Fid)
-
-	if name != "" {
-		baseName := path.Base(name)
-		ret.FileName = baseName
-		ret.RealName = baseName
-		ext := strings.ToLower(path.Ext(baseName))
-
-		if ext != "" {
-			ret.MimeType = mime.TypeByExtension(ext)
-			// The SeaweedFS handle the file with .gz suffix for a special treatment,
-			// so we need to retain all the file suffix.
-			// However, the file with ".css.gz"、".html.gz"、".txt.gz"、".js.gz" etc
-			// will remove the ".gz" suffix, fit for the browser download.
-			// This will cause the MD5 value of the httpClient request inconsistent.
-			if ext == ".gz" {
-				ret.IsGzipped = true
-				if needRename(baseName, ext) {
-					ret.FileName = ret.Fid + ".gz"
-				}
-			}
-		}
-	}
-	glog.V(4).Infof("Create seaweed file %s", ret)
+// Overwrite returns a file to write the new content of the existing fid id to,
+// the content replaces the old version when the file is closed.
+func Overwrite(id string, domain int64, seeds string, chunkSize int64) (*WeedFile, error) {
+	return OverwriteContext(context.Background(), id, domain, seeds, chunkSize)
+}
+
+// OverwriteContext is like Overwrite but the file is bound to ctx.
+func OverwriteContext(ctx context.Context, id string, domain int64, seeds string, chunkSize int64) (*WeedFile, error) {
+	return defaultClient(seeds, "", "", "").OverwriteWithOptions(ctx, id, &CreateOptions{
+		Domain:    domain,
+		ChunkSize: chunkSize,
+	})
+}
+
+// OverwriteWithOptions overwrites the file id on the cluster of seeds,
+// the new version is specified by opts.
+func OverwriteWithOptions(ctx context.Context, seeds, id string, opts *CreateOptions) (*WeedFile, error) {
+	return defaultClient(seeds, "", "", "").OverwriteWithOptions(ctx, id, opts)
+}
 
-	return ret, nil
+// OpenAppend opens the existing file id to append to, the data written
+// is uploaded as new chunks and the manifest is uploaded again by Close.
+func OpenAppend(id string, domain int64, seeds string, chunkSize int64) (*WeedFile, error) {
+	return OpenAppendContext(context.Background(), id, domain, seeds, chunkSize)
+}
+
+// OpenAppendContext is like OpenAppend but the file is bound to ctx.
+func OpenAppendContext(ctx context.Context, id string, domain int64, seeds string, chunkSize int64) (*WeedFile, error) {
+	return defaultClient(seeds, "", "", "").OpenAppendWithOptions(ctx, id, &CreateOptions{
+		Domain:    domain,
+		ChunkSize: chunkSize,
+	})
 }
 
 // suit for storage/needle.go logic.
@@ -364,45 +645,20 @@ func needRename(s, ext string) bool {
 // return the standard io.Reader.
 // Provide the stream operation of file for download.
 func Open(id string, domain int64, seeds string) (*WeedFile, error) {
-	ret := &WeedFile{
-		Fid:      id,
-		readFlag: true,
-		seeds:    seeds,
-	}
-
-	locations, err := utils.LookupFileId(ret.seeds, ret.Fid)
-	if err != nil {
-		return nil, err
-	}
-	// Add retry mechanism
-	var fileUrl, filename string
-	var rc io.ReadCloser
-	for _, location := range locations {
-		fileUrl = fmt.Sprintf("http://%s/%s", location.PublicUrl, ret.Fid)
-		filename, rc, err = utils.DownloadUrl(fileUrl)
-		if err == nil {
-			break
-		}
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	if filename == "" {
-		filename = id
-	}
-	ret.FileName = filename
-	ret.RealName = filename
-	ret.FileUrl = fileUrl
-	ret.reader = rc
+	return OpenContext(context.Background(), id, domain, seeds)
+}
 
-	glog.V(4).Infof("Open seaweed file url: %s...", fileUrl)
-	return ret, nil
+// OpenContext is like Open but the download is bound to ctx,
+// reading from the file fails once ctx is done.
+func OpenContext(ctx context.Context, id string, domain int64, seeds string) (*WeedFile, error) {
+	return defaultClient(seeds, "", "", "").OpenContext(ctx, id, domain)
 }
 
 func Remove(id string, domain int64, seeds string) (bool, error) {
-	if e := utils.DeleteFile(seeds, id); e != nil {
-		return false, e
-	}
-	return true, nil
+	return RemoveContext(context.Background(), id, domain, seeds)
+}
+
+// RemoveContext is like Remove but every request is bound to ctx.
+func RemoveContext(ctx context.Context, id string, domain int64, seeds string) (bool, error) {
+	return defaultClient(seeds, "", "", "").RemoveContext(ctx, id, domain)
 }